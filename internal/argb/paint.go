@@ -0,0 +1,215 @@
+package argb
+
+import (
+	"math"
+
+	"github.com/BurntSushi/xgb/render"
+	"github.com/BurntSushi/xgb/xproto"
+	"github.com/kijimaD/xruler/internal/resource"
+)
+
+const (
+	tileWidth   = 64 // 縦方向のグラデーションを横に敷き詰める背景Pixmapの幅
+	capSegments = 16 // 線の端の丸を近似する三角形の数
+)
+
+// Fill ウィンドウの背景の塗り方
+type Fill struct {
+	Color   uint32 // 塗る色（0xRRGGBB）
+	Feather int    // 上下の端を透明へぼかす幅（ピクセル、ARGBの場合のみ）
+}
+
+// Line 線分（ウィンドウ内の座標）
+type Line struct {
+	X1, Y1 int
+	X2, Y2 int
+	Width  int    // 線の太さ
+	Color  uint32 // 線の色（0xRRGGBB）
+}
+
+// CreateWindow 背景をfillで塗ったウィンドウを作る
+// ぼかしはARGBビジュアルでのみ描画し、それ以外は単色になる。
+// ぼかしは高さに合わせて描画するため、高さを変える場合は作り直すこと
+func (s *Screen) CreateWindow(win xproto.Window, x, y, width, height int, fill Fill) error {
+	return s.CreateSubwindow(win, s.root, x, y, width, height, fill)
+}
+
+// CreateSubwindow 背景をfillで塗ったウィンドウをparentの子として作る
+// 座標はparentの左上からの位置になる
+func (s *Screen) CreateSubwindow(win, parent xproto.Window, x, y, width, height int, fill Fill) error {
+	if !s.argb {
+		return s.createWindow(win, parent, x, y, width, height, xproto.CwBackPixel, fill.Color)
+	}
+
+	feather := min(fill.Feather, height/2)
+	if feather <= 0 {
+		return s.createWindow(win, parent, x, y, width, height, xproto.CwBackPixel, opaque(fill.Color))
+	}
+
+	pixmap, err := s.paint(tileWidth, height, func(pic render.Picture) error {
+		return s.fillFeathered(pic, tileWidth, height, feather, fill.Color)
+	})
+	if err != nil {
+		return err
+	}
+	// ウィンドウが背景として参照している間はPixmapは残る
+	defer s.freePixmap(pixmap)
+
+	return s.createWindow(win, parent, x, y, width, height, xproto.CwBackPixmap, uint32(pixmap))
+}
+
+// CreateLineWindow アンチエイリアスした線分を背景に描いたウィンドウを作る
+// 線以外は透明になるため、ARGBビジュアルでのみ使える
+func (s *Screen) CreateLineWindow(win xproto.Window, x, y, width, height int, line Line) error {
+	pixmap, err := s.paint(width, height, func(pic render.Picture) error {
+		return s.strokeLine(pic, line)
+	})
+	if err != nil {
+		return err
+	}
+	defer s.freePixmap(pixmap)
+
+	return s.createWindow(win, s.root, x, y, width, height, xproto.CwBackPixmap, uint32(pixmap))
+}
+
+// paint 透明で初期化した背景Pixmapを作り、drawで描画する
+func (s *Screen) paint(width, height int, draw func(pic render.Picture) error) (xproto.Pixmap, error) {
+	width, height = max(1, width), max(1, height)
+
+	pixmap, err := xproto.NewPixmapId(s.conn)
+	if err != nil {
+		return 0, err
+	}
+	if err := xproto.CreatePixmapChecked(s.conn, s.depth, pixmap, xproto.Drawable(s.root),
+		uint16(width), uint16(height)).Check(); err != nil {
+		return 0, err
+	}
+	s.res.Add(resource.Pixmap, uint32(pixmap))
+
+	pic, err := render.NewPictureId(s.conn)
+	if err != nil {
+		s.freePixmap(pixmap)
+		return 0, err
+	}
+	if err := render.CreatePictureChecked(s.conn, pic, xproto.Drawable(pixmap), s.format, 0, nil).Check(); err != nil {
+		s.freePixmap(pixmap)
+		return 0, err
+	}
+	s.res.Add(resource.Picture, uint32(pic))
+	defer s.freePicture(pic)
+
+	render.FillRectangles(s.conn, render.PictOpSrc, pic, render.Color{},
+		[]xproto.Rectangle{{Width: uint16(width), Height: uint16(height)}})
+
+	if err := draw(pic); err != nil {
+		s.freePixmap(pixmap)
+		return 0, err
+	}
+	return pixmap, nil
+}
+
+// fillFeathered 上下の端が透明へ変わる縦方向のグラデーションで塗る
+func (s *Screen) fillFeathered(dst render.Picture, width, height, feather int, rgb uint32) error {
+	gradient, err := render.NewPictureId(s.conn)
+	if err != nil {
+		return err
+	}
+
+	edge := float64(feather) / float64(height)
+	solid, clear := color(rgb, 1), color(rgb, 0)
+	if err := render.CreateLinearGradientChecked(s.conn, gradient,
+		render.Pointfix{X: 0, Y: 0},
+		render.Pointfix{X: 0, Y: fixed(float64(height))},
+		4,
+		[]render.Fixed{0, fixed(edge), fixed(1 - edge), fixed(1)},
+		[]render.Color{clear, solid, solid, clear},
+	).Check(); err != nil {
+		return err
+	}
+	s.res.Add(resource.Picture, uint32(gradient))
+	defer s.freePicture(gradient)
+
+	render.Composite(s.conn, render.PictOpSrc, gradient, render.PictureNone, dst,
+		0, 0, 0, 0, 0, 0, uint16(width), uint16(height))
+	return nil
+}
+
+// strokeLine 丸い端の太い線分をアンチエイリアスして描く
+func (s *Screen) strokeLine(dst render.Picture, line Line) error {
+	src, err := render.NewPictureId(s.conn)
+	if err != nil {
+		return err
+	}
+	if err := render.CreateSolidFillChecked(s.conn, src, color(line.Color, 1)).Check(); err != nil {
+		return err
+	}
+	s.res.Add(resource.Picture, uint32(src))
+	defer s.freePicture(src)
+
+	render.Triangles(s.conn, render.PictOpOver, src, dst, s.mask, 0, 0, lineTriangles(line))
+	return nil
+}
+
+// lineTriangles 太さのある線分を三角形に分割する（両端は半円で丸める）
+func lineTriangles(line Line) []render.Triangle {
+	x1, y1 := float64(line.X1), float64(line.Y1)
+	x2, y2 := float64(line.X2), float64(line.Y2)
+	r := float64(line.Width) / 2
+
+	var triangles []render.Triangle
+	if length := math.Hypot(x2-x1, y2-y1); length > 0 {
+		// 線分に垂直な方向へ太さの半分だけずらした四角形
+		nx, ny := -(y2-y1)/length*r, (x2-x1)/length*r
+		a := point(x1+nx, y1+ny)
+		b := point(x1-nx, y1-ny)
+		c := point(x2-nx, y2-ny)
+		d := point(x2+nx, y2+ny)
+		triangles = append(triangles,
+			render.Triangle{P1: a, P2: b, P3: c},
+			render.Triangle{P1: a, P2: c, P3: d},
+		)
+	}
+
+	for _, center := range [][2]float64{{x1, y1}, {x2, y2}} {
+		cx, cy := center[0], center[1]
+		for i := 0; i < capSegments; i++ {
+			t1 := 2 * math.Pi * float64(i) / capSegments
+			t2 := 2 * math.Pi * float64(i+1) / capSegments
+			triangles = append(triangles, render.Triangle{
+				P1: point(cx, cy),
+				P2: point(cx+r*math.Cos(t1), cy+r*math.Sin(t1)),
+				P3: point(cx+r*math.Cos(t2), cy+r*math.Sin(t2)),
+			})
+		}
+	}
+
+	return triangles
+}
+
+// opaque 不透明な色をARGBビジュアルのピクセル値にする
+func opaque(rgb uint32) uint32 {
+	return 0xff000000 | rgb&0xffffff
+}
+
+// color 0xRRGGBBの色と不透明度(0-1)をRENDERの色にする
+// グラデーションの色はアルファを乗算しない値で指定するため、乗算しない
+func color(rgb uint32, alpha float64) render.Color {
+	channel := func(shift uint) uint16 {
+		return uint16((rgb>>shift)&0xff) * 0x101
+	}
+	return render.Color{
+		Red:   channel(16),
+		Green: channel(8),
+		Blue:  channel(0),
+		Alpha: uint16(math.Round(alpha * 0xffff)),
+	}
+}
+
+// fixed 実数をRENDERの16.16固定小数点数にする
+func fixed(v float64) render.Fixed {
+	return render.Fixed(math.Round(v * 65536))
+}
+
+func point(x, y float64) render.Pointfix {
+	return render.Pointfix{X: fixed(x), Y: fixed(y)}
+}
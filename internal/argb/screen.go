@@ -0,0 +1,186 @@
+// Package argb 32ビットARGBビジュアルのウィンドウを作り、RENDER拡張で背景を描画する
+//
+// ARGBビジュアルが使えない環境では画面既定の24ビットビジュアルで単色のウィンドウを作る
+package argb
+
+import (
+	"github.com/BurntSushi/xgb"
+	"github.com/BurntSushi/xgb/render"
+	"github.com/BurntSushi/xgb/xproto"
+	"github.com/kijimaD/xruler/internal/resource"
+)
+
+const (
+	renderMajor = 0  // RENDER拡張のメジャーバージョン
+	renderMinor = 11 // RENDER拡張のマイナーバージョン（グラデーションに0.10以上が必要）
+	argbDepth   = 32 // ARGBビジュアルの深さ
+	maskDepth   = 8  // アンチエイリアスのマスクの深さ
+)
+
+// Screen ウィンドウを作るビジュアルと、描画に使うRENDERのフォーマット
+type Screen struct {
+	conn     *xgb.Conn
+	root     xproto.Window
+	visual   xproto.Visualid   // ウィンドウのビジュアル
+	depth    byte              // ウィンドウの深さ
+	colormap xproto.Colormap   // ARGBビジュアル用のカラーマップ
+	format   render.Pictformat // ウィンドウと背景Pixmapのフォーマット
+	mask     render.Pictformat // アンチエイリアスのマスクに使う8ビットアルファのフォーマット
+	argb     bool              // 32ビットARGBビジュアルを使う
+	res      *resource.Tracker // 作成した資源の記録（nilなら記録しない）
+
+	composited bool // コンポジットマネージャがあり、透明度が反映される
+}
+
+// Open ウィンドウを作るビジュアルを選ぶ
+// compositedがtrue（コンポジットマネージャがある）で、RENDER拡張と32ビットTrueColorの
+// ARGBビジュアルが使える場合はそれを選び、専用のカラーマップを作る。
+// 使えなければ画面既定のビジュアルを使う（アルファが反映されないため）。
+// 作成したカラーマップや描画に使う資源はresに記録する
+func Open(conn *xgb.Conn, composited bool, res *resource.Tracker) (*Screen, error) {
+	screen := xproto.Setup(conn).DefaultScreen(conn)
+	s := &Screen{
+		conn:       conn,
+		root:       screen.Root,
+		visual:     screen.RootVisual,
+		depth:      screen.RootDepth,
+		res:        res,
+		composited: composited,
+	}
+	if !composited {
+		return s, nil
+	}
+
+	visual, format, mask, ok := findARGB(conn, screen)
+	if !ok {
+		return s, nil
+	}
+
+	colormap, err := xproto.NewColormapId(conn)
+	if err != nil {
+		return nil, err
+	}
+	if err := xproto.CreateColormapChecked(conn, xproto.ColormapAllocNone, colormap, screen.Root, visual).Check(); err != nil {
+		return nil, err
+	}
+	res.Add(resource.Colormap, uint32(colormap))
+
+	s.visual = visual
+	s.depth = argbDepth
+	s.colormap = colormap
+	s.format = format
+	s.mask = mask
+	s.argb = true
+	return s, nil
+}
+
+// findARGB 32ビットTrueColorのビジュアルのうち、RENDERでアルファを持つものを探す
+func findARGB(conn *xgb.Conn, screen *xproto.ScreenInfo) (xproto.Visualid, render.Pictformat, render.Pictformat, bool) {
+	if err := render.Init(conn); err != nil {
+		return 0, 0, 0, false
+	}
+	if _, err := render.QueryVersion(conn, renderMajor, renderMinor).Reply(); err != nil {
+		return 0, 0, 0, false
+	}
+	formats, err := render.QueryPictFormats(conn).Reply()
+	if err != nil {
+		return 0, 0, 0, false
+	}
+
+	infos := make(map[render.Pictformat]render.Pictforminfo, len(formats.Formats))
+	var mask render.Pictformat
+	for _, info := range formats.Formats {
+		infos[info.Id] = info
+		if info.Type == render.PictTypeDirect && info.Depth == maskDepth &&
+			info.Direct.AlphaMask == 0xff && info.Direct.RedMask == 0 {
+			mask = info.Id
+		}
+	}
+	if mask == 0 {
+		return 0, 0, 0, false
+	}
+
+	// RENDERが各ビジュアルに割り当てたフォーマット
+	visualFormats := make(map[xproto.Visualid]render.Pictformat)
+	for _, ps := range formats.Screens {
+		for _, pd := range ps.Depths {
+			for _, pv := range pd.Visuals {
+				visualFormats[pv.Visual] = pv.Format
+			}
+		}
+	}
+
+	for _, depth := range screen.AllowedDepths {
+		if depth.Depth != argbDepth {
+			continue
+		}
+		for _, visual := range depth.Visuals {
+			if visual.Class != xproto.VisualClassTrueColor {
+				continue
+			}
+			format, ok := visualFormats[visual.VisualId]
+			if ok && infos[format].Direct.AlphaMask != 0 {
+				return visual.VisualId, format, mask, true
+			}
+		}
+	}
+
+	return 0, 0, 0, false
+}
+
+// ARGB 32ビットARGBビジュアルを使っているかを返す
+func (s *Screen) ARGB() bool {
+	return s.argb
+}
+
+// Composited コンポジットマネージャがあり、ウィンドウの透明度が反映されるかを返す
+func (s *Screen) Composited() bool {
+	return s.composited
+}
+
+// Free 作成したカラーマップを解放する
+func (s *Screen) Free() {
+	if s.colormap != 0 {
+		xproto.FreeColormap(s.conn, s.colormap)
+		s.res.Remove(uint32(s.colormap))
+		s.colormap = 0
+	}
+}
+
+// createWindow 背景を指定してoverride-redirectのウィンドウをparentの子として作る
+// backgroundはCwBackPixelかCwBackPixmapのどちらか
+func (s *Screen) createWindow(win, parent xproto.Window, x, y, width, height int, backgroundMask, background uint32) error {
+	mask := backgroundMask | xproto.CwBorderPixel | xproto.CwOverrideRedirect
+	values := []uint32{background, 0, 1}
+	if s.argb {
+		// 親と深さが異なるウィンドウには枠の色とカラーマップの指定が必要
+		mask |= xproto.CwColormap
+		values = append(values, uint32(s.colormap))
+	}
+
+	return xproto.CreateWindowChecked(
+		s.conn,
+		s.depth,
+		win,
+		parent,
+		int16(x), int16(y),
+		uint16(max(1, width)), uint16(max(1, height)),
+		0,
+		xproto.WindowClassInputOutput,
+		s.visual,
+		mask,
+		values,
+	).Check()
+}
+
+// freePixmap Pixmapを解放する
+func (s *Screen) freePixmap(pixmap xproto.Pixmap) {
+	xproto.FreePixmap(s.conn, pixmap)
+	s.res.Remove(uint32(pixmap))
+}
+
+// freePicture Pictureを解放する
+func (s *Screen) freePicture(pic render.Picture) {
+	render.FreePicture(s.conn, pic)
+	s.res.Remove(uint32(pic))
+}
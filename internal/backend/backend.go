@@ -0,0 +1,62 @@
+// Package backend ルーラーと軌跡がウィンドウを表示するための操作をまとめる
+//
+// Xサーバーを使う X11 と、呼び出しを記録するだけの Fake がある
+package backend
+
+// Window バックエンドが作ったウィンドウの識別子
+type Window uint32
+
+// Rect 矩形（ウィンドウを作る時はルートウィンドウ座標、形を決める時はウィンドウ内の座標）
+type Rect struct {
+	X, Y          int
+	Width, Height int
+}
+
+// Line 線分（ウィンドウ内の座標）
+type Line struct {
+	X1, Y1 int
+	X2, Y2 int
+	Width  int    // 線の太さ
+	Color  uint32 // 線の色（0xRRGGBB）
+}
+
+// WindowSpec 作成するウィンドウ
+type WindowSpec struct {
+	Parent   Window // 親ウィンドウ（0ならルートウィンドウ、それ以外は親の左上からの座標）
+	Rect     Rect   // 位置と大きさ
+	Color    uint32 // 背景色（0xRRGGBB）
+	Feather  int    // 上下の端を透明へぼかす幅（ピクセル、ARGBビジュアルの場合のみ）
+	Fallback string // コンポジットマネージャがない時の描き方（空ならsolid）
+	Line     *Line  // 指定すると線分だけを表示するウィンドウにする（Colorは使わない）
+	Owner    string // ウィンドウを使うサブシステムの名前（Xエラーの原因を示すのに使う）
+}
+
+// Backend ウィンドウの作成・配置と、カーソルやキーの入力
+type Backend interface {
+	// CreateWindow ウィンドウを作る（表示はしない）
+	CreateWindow(spec WindowSpec) (Window, error)
+	// ConfigureWindow ウィンドウの位置と大きさを変える
+	ConfigureWindow(win Window, rect Rect)
+	// MapWindow ウィンドウを表示する
+	MapWindow(win Window)
+	// UnmapWindow ウィンドウを隠す
+	UnmapWindow(win Window)
+	// DestroyWindow ウィンドウを破棄する
+	DestroyWindow(win Window)
+	// SetShape ウィンドウの表示する部分を矩形の集まりにする（空なら何も表示しない）
+	SetShape(win Window, rects []Rect) error
+	// SetOpacity ウィンドウの不透明度（パーセント: 0-100）を設定する
+	SetOpacity(win Window, percent float64) error
+	// SetOpacityUnchecked 応答を待たずにウィンドウの不透明度を設定する（毎フレーム変える場合に使う）
+	SetOpacityUnchecked(win Window, percent float64)
+	// SetClickThrough マウスのクリックがウィンドウを通り抜けるようにする
+	SetClickThrough(win Window) error
+	// QueryPointer カーソル位置（ルートウィンドウ座標）を返す
+	QueryPointer() (int, int, error)
+	// GrabKey キーをグローバルに割り当て、押されたらfnを呼ぶ
+	GrabKey(key string, fn func()) error
+	// UngrabKeys 割り当てたキーをすべて解除する
+	UngrabKeys()
+	// Flush 送ったリクエストが処理されるのを待つ
+	Flush()
+}
@@ -0,0 +1,244 @@
+package backend
+
+import (
+	"fmt"
+	"sync"
+)
+
+// FakeWindow Fakeが記録したウィンドウの状態
+type FakeWindow struct {
+	Spec         WindowSpec // 作成時の指定
+	Rect         Rect       // 現在の位置と大きさ
+	Shape        []Rect     // 表示する部分（nilなら切り抜いていない）
+	Opacity      float64    // 不透明度（パーセント、未設定なら-1）
+	ClickThrough bool       // クリックスルーを設定したか
+	Mapped       bool       // 表示中か
+	Destroyed    bool       // 破棄したか
+}
+
+// Fake 呼び出しを記録するだけのバックエンド（Xサーバーなしでテストするために使う）
+type Fake struct {
+	mu       sync.Mutex
+	next     Window
+	windows  map[Window]*FakeWindow
+	keys     map[string]func()
+	calls    []string
+	x, y     int
+	err      error
+	GrabErrs map[string]error // キーごとに GrabKey が返すエラー
+}
+
+// NewFake Fakeバックエンドを作成
+func NewFake() *Fake {
+	return &Fake{
+		windows:  make(map[Window]*FakeWindow),
+		keys:     make(map[string]func()),
+		GrabErrs: make(map[string]error),
+	}
+}
+
+// SetPointer QueryPointerが返すカーソル位置とエラーを決める
+func (f *Fake) SetPointer(x, y int, err error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.x, f.y, f.err = x, y, err
+}
+
+// Window 記録したウィンドウの状態を返す
+func (f *Fake) Window(win Window) (FakeWindow, bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	w, ok := f.windows[win]
+	if !ok {
+		return FakeWindow{}, false
+	}
+	return *w, true
+}
+
+// Live 破棄されていないウィンドウを作成順に返す
+func (f *Fake) Live() []Window {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var live []Window
+	for win := Window(1); win <= f.next; win++ {
+		if w, ok := f.windows[win]; ok && !w.Destroyed {
+			live = append(live, win)
+		}
+	}
+	return live
+}
+
+// Calls 呼び出しの記録を返す（"MapWindow 1" のようにメソッド名と引数）
+func (f *Fake) Calls() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]string(nil), f.calls...)
+}
+
+// ResetCalls 呼び出しの記録を消す
+func (f *Fake) ResetCalls() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.calls = nil
+}
+
+// Keys 割り当て中のキーを返す
+func (f *Fake) Keys() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	keys := make([]string, 0, len(f.keys))
+	for key := range f.keys {
+		keys = append(keys, key)
+	}
+	return keys
+}
+
+// Press 割り当てたキーが押されたことにする（割り当てがなければfalseを返す）
+func (f *Fake) Press(key string) bool {
+	f.mu.Lock()
+	fn, ok := f.keys[key]
+	f.mu.Unlock()
+	if ok {
+		fn()
+	}
+	return ok
+}
+
+// record 呼び出しを記録する
+// 呼び出し側で f.mu をロックしておくこと
+func (f *Fake) record(format string, args ...any) {
+	f.calls = append(f.calls, fmt.Sprintf(format, args...))
+}
+
+// window 操作対象のウィンドウを返す（存在しないか破棄済みなら、Xサーバーと同じく操作を無視する）
+// 呼び出し側で f.mu をロックしておくこと
+func (f *Fake) window(win Window) *FakeWindow {
+	w, ok := f.windows[win]
+	if !ok || w.Destroyed {
+		return nil
+	}
+	return w
+}
+
+func (f *Fake) CreateWindow(spec WindowSpec) (Window, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.next++
+	f.windows[f.next] = &FakeWindow{Spec: spec, Rect: spec.Rect, Opacity: -1}
+	f.record("CreateWindow %d", f.next)
+	return f.next, nil
+}
+
+func (f *Fake) ConfigureWindow(win Window, rect Rect) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.record("ConfigureWindow %d %+v", win, rect)
+	if w := f.window(win); w != nil {
+		w.Rect = rect
+	}
+}
+
+func (f *Fake) MapWindow(win Window) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.record("MapWindow %d", win)
+	if w := f.window(win); w != nil {
+		w.Mapped = true
+	}
+}
+
+func (f *Fake) UnmapWindow(win Window) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.record("UnmapWindow %d", win)
+	if w := f.window(win); w != nil {
+		w.Mapped = false
+	}
+}
+
+func (f *Fake) DestroyWindow(win Window) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.record("DestroyWindow %d", win)
+	if w := f.window(win); w != nil {
+		w.Mapped = false
+		w.Destroyed = true
+	}
+	// 子ウィンドウも一緒に破棄される
+	for _, w := range f.windows {
+		if w.Spec.Parent == win {
+			w.Mapped = false
+			w.Destroyed = true
+		}
+	}
+}
+
+func (f *Fake) SetShape(win Window, rects []Rect) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.record("SetShape %d %+v", win, rects)
+	if w := f.window(win); w != nil {
+		w.Shape = append([]Rect{}, rects...)
+	}
+	return nil
+}
+
+func (f *Fake) SetOpacity(win Window, percent float64) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.record("SetOpacity %d %g", win, percent)
+	if w := f.window(win); w != nil {
+		w.Opacity = percent
+	}
+	return nil
+}
+
+func (f *Fake) SetOpacityUnchecked(win Window, percent float64) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.record("SetOpacityUnchecked %d %g", win, percent)
+	if w := f.window(win); w != nil {
+		w.Opacity = percent
+	}
+}
+
+func (f *Fake) SetClickThrough(win Window) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.record("SetClickThrough %d", win)
+	if w := f.window(win); w != nil {
+		w.ClickThrough = true
+	}
+	return nil
+}
+
+func (f *Fake) QueryPointer() (int, int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.err != nil {
+		return -1, -1, f.err
+	}
+	return f.x, f.y, nil
+}
+
+func (f *Fake) GrabKey(key string, fn func()) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.record("GrabKey %s", key)
+	if err := f.GrabErrs[key]; err != nil {
+		return err
+	}
+	f.keys[key] = fn
+	return nil
+}
+
+func (f *Fake) UngrabKeys() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.record("UngrabKeys")
+	f.keys = make(map[string]func())
+}
+
+func (f *Fake) Flush() {}
+
+var _ Backend = (*Fake)(nil)
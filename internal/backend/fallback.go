@@ -0,0 +1,159 @@
+package backend
+
+import (
+	"fmt"
+
+	"github.com/BurntSushi/xgb/shape"
+	"github.com/BurntSushi/xgb/xproto"
+	"github.com/kijimaD/xruler/internal/resource"
+)
+
+// コンポジットマネージャがない時のルーラーの描き方
+const (
+	FallbackSolid   = "solid"   // 不透明な帯（下の文字は隠れる）
+	FallbackStipple = "stipple" // 1ピクセルおきの市松模様（下の文字が半分見える）
+	FallbackOutline = "outline" // 上下の線だけ
+)
+
+const outlineWidth = 2 // outlineで描く線の太さ（ピクセル）
+
+// FallbackStyles 利用できる描き方の一覧を返す
+func FallbackStyles() []string {
+	return []string{FallbackSolid, FallbackStipple, FallbackOutline}
+}
+
+// applyFallback 半透明にできない環境で、下の文字が読めるようSHAPEでウィンドウを間引く
+func (x *X11) applyFallback(win xproto.Window, width, height int, style string) error {
+	switch style {
+	case FallbackSolid, "":
+		return nil
+	case FallbackStipple, FallbackOutline:
+	default:
+		return fmt.Errorf("不明な描き方です: %q", style)
+	}
+
+	if x.shape != nil {
+		return x.shape
+	}
+	conn := x.xuConn.Conn()
+
+	if style == FallbackOutline {
+		line := uint16(min(outlineWidth, height))
+		return shape.RectanglesChecked(conn, shape.SoSet, shape.SkBounding, xproto.ClipOrderingUnsorted, win, 0, 0,
+			[]xproto.Rectangle{
+				{Width: uint16(width), Height: line},
+				{Y: int16(height - int(line)), Width: uint16(width), Height: line},
+			}).Check()
+	}
+
+	mask, err := x.stippleMask(win, width, height)
+	if err != nil {
+		return err
+	}
+	defer x.freePixmap(mask)
+
+	return shape.MaskChecked(conn, shape.SoSet, shape.SkBounding, win, 0, 0, mask).Check()
+}
+
+// stippleMask 市松模様の1ビットのマスクを作る
+func (x *X11) stippleMask(drawable xproto.Window, width, height int) (xproto.Pixmap, error) {
+	conn := x.xuConn.Conn()
+
+	// 2x2の模様を作り、マスク全体に敷き詰める
+	pattern, err := x.newBitmap(drawable, 2, 2)
+	if err != nil {
+		return 0, err
+	}
+	defer x.freePixmap(pattern)
+
+	gc, err := x.newGC(xproto.Drawable(pattern))
+	if err != nil {
+		return 0, err
+	}
+	defer x.freeGC(gc)
+
+	xproto.PolyFillRectangle(conn, xproto.Drawable(pattern), gc, []xproto.Rectangle{{Width: 2, Height: 2}})
+	xproto.ChangeGC(conn, gc, xproto.GcForeground, []uint32{1})
+	xproto.PolyPoint(conn, xproto.CoordModeOrigin, xproto.Drawable(pattern), gc, []xproto.Point{{X: 0, Y: 0}, {X: 1, Y: 1}})
+
+	mask, err := x.newBitmap(drawable, width, height)
+	if err != nil {
+		return 0, err
+	}
+	xproto.ChangeGC(conn, gc, xproto.GcForeground|xproto.GcBackground|xproto.GcFillStyle|xproto.GcStipple,
+		[]uint32{1, 0, xproto.FillStyleOpaqueStippled, uint32(pattern)})
+	xproto.PolyFillRectangle(conn, xproto.Drawable(mask), gc,
+		[]xproto.Rectangle{{Width: uint16(width), Height: uint16(height)}})
+
+	return mask, nil
+}
+
+// lineMask 線分の形の1ビットのマスクを作る
+func (x *X11) lineMask(drawable xproto.Window, width, height int, line Line) (xproto.Pixmap, error) {
+	conn := x.xuConn.Conn()
+
+	mask, err := x.newBitmap(drawable, width, height)
+	if err != nil {
+		return 0, err
+	}
+
+	gc, err := x.newGC(xproto.Drawable(mask))
+	if err != nil {
+		x.freePixmap(mask)
+		return 0, err
+	}
+	defer x.freeGC(gc)
+
+	// マスクを透明でクリアしてから、線の部分を不透明にする
+	xproto.PolyFillRectangle(conn, xproto.Drawable(mask), gc,
+		[]xproto.Rectangle{{Width: uint16(width), Height: uint16(height)}})
+	xproto.ChangeGC(conn, gc, xproto.GcForeground|xproto.GcLineWidth|xproto.GcCapStyle|xproto.GcJoinStyle,
+		[]uint32{1, uint32(line.Width), xproto.CapStyleRound, xproto.JoinStyleRound})
+	xproto.PolyLine(conn, xproto.CoordModeOrigin, xproto.Drawable(mask), gc, []xproto.Point{
+		{X: int16(line.X1), Y: int16(line.Y1)},
+		{X: int16(line.X2), Y: int16(line.Y2)},
+	})
+
+	return mask, nil
+}
+
+// newBitmap 深さ1のPixmapを作る
+func (x *X11) newBitmap(drawable xproto.Window, width, height int) (xproto.Pixmap, error) {
+	conn := x.xuConn.Conn()
+	pixmap, err := xproto.NewPixmapId(conn)
+	if err != nil {
+		return 0, err
+	}
+	if err := xproto.CreatePixmapChecked(conn, 1, pixmap, xproto.Drawable(drawable),
+		uint16(max(1, width)), uint16(max(1, height))).Check(); err != nil {
+		return 0, err
+	}
+	x.res.Add(resource.Pixmap, uint32(pixmap))
+	return pixmap, nil
+}
+
+// newGC 前景色0のGCを作る
+func (x *X11) newGC(drawable xproto.Drawable) (xproto.Gcontext, error) {
+	conn := x.xuConn.Conn()
+	gc, err := xproto.NewGcontextId(conn)
+	if err != nil {
+		return 0, err
+	}
+	if err := xproto.CreateGCChecked(conn, gc, drawable, xproto.GcForeground, []uint32{0}).Check(); err != nil {
+		return 0, err
+	}
+	x.res.Add(resource.GC, uint32(gc))
+	return gc, nil
+}
+
+// freePixmap Pixmapを解放する
+func (x *X11) freePixmap(pixmap xproto.Pixmap) {
+	xproto.FreePixmap(x.xuConn.Conn(), pixmap)
+	x.res.Remove(uint32(pixmap))
+}
+
+// freeGC GCを解放する
+func (x *X11) freeGC(gc xproto.Gcontext) {
+	xproto.FreeGC(x.xuConn.Conn(), gc)
+	x.res.Remove(uint32(gc))
+}
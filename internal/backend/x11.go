@@ -0,0 +1,342 @@
+package backend
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/BurntSushi/xgb"
+	"github.com/BurntSushi/xgb/shape"
+	"github.com/BurntSushi/xgb/xfixes"
+	"github.com/BurntSushi/xgb/xproto"
+	"github.com/BurntSushi/xgbutil"
+	"github.com/BurntSushi/xgbutil/keybind"
+	"github.com/BurntSushi/xgbutil/xevent"
+	"github.com/kijimaD/xruler/internal/argb"
+	"github.com/kijimaD/xruler/internal/resource"
+)
+
+const (
+	xfixesMajor     = 6                        // XFixes拡張のメジャーバージョン
+	xfixesMinor     = 0                        // XFixes拡張のマイナーバージョン
+	extensionXFIXES = "XFIXES"                 // XFixes拡張の名前
+	AtomOpacity     = "_NET_WM_WINDOW_OPACITY" // ウィンドウ不透明度を設定するアトム名
+	replyTimeout    = 5 * time.Second          // 応答がない時に接続が切れたとみなすまでの時間
+)
+
+// ErrNoExtension Xサーバーに拡張がないことを表すエラー
+var ErrNoExtension = errors.New("Xサーバーに拡張がありません")
+
+var _ Backend = (*X11)(nil)
+
+// X11 Xサーバーにウィンドウを作るバックエンド
+type X11 struct {
+	xConn   *xgb.Conn         // ウィンドウの操作に使う接続
+	xuConn  *xgbutil.XUtil    // ウィンドウの作成とキーの割り当てに使う接続（screenと同じ接続）
+	screen  *argb.Screen      // ウィンドウを作るビジュアル
+	res     *resource.Tracker // 作成した資源の記録（nilなら記録しない）
+	abandon func()            // カーソル位置の応答がない時に呼ぶ（nilなら待ち続ける）
+	shape   error             // SHAPE拡張の初期化エラー
+	opacity xproto.Atom       // 不透明度のアトム（取得するまではAtomNone）
+}
+
+// NewX11 X11バックエンドを作成
+// screenはxuConnの接続で開いておくこと。GrabKeyを使う前に keybind.Initialize を呼んでおくこと。
+// 作成したウィンドウなどの資源はresに記録する
+func NewX11(xConn *xgb.Conn, xuConn *xgbutil.XUtil, screen *argb.Screen, res *resource.Tracker, abandon func()) *X11 {
+	return &X11{
+		xConn:   xConn,
+		xuConn:  xuConn,
+		screen:  screen,
+		res:     res,
+		abandon: abandon,
+		shape:   initShape(xConn, xuConn.Conn()),
+	}
+}
+
+// initShape 両方の接続でSHAPE拡張を初期化する
+// 形の変更はxConnで、作成時の切り抜きはウィンドウを作る接続で送るため
+func initShape(conns ...*xgb.Conn) error {
+	for _, conn := range conns {
+		if err := shape.Init(conn); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// InitXFixes XFixes拡張を初期化し、Xサーバーが対応するバージョンを返す
+// 拡張がない場合は ErrNoExtension を返す
+func InitXFixes(conn *xgb.Conn) (*xfixes.QueryVersionReply, error) {
+	extension, err := xproto.QueryExtension(conn, uint16(len(extensionXFIXES)), extensionXFIXES).Reply()
+	if err != nil {
+		return nil, err
+	}
+	if !extension.Present {
+		return nil, fmt.Errorf("%s: %w", extensionXFIXES, ErrNoExtension)
+	}
+
+	if err := xfixes.Init(conn); err != nil {
+		return nil, err
+	}
+	return xfixes.QueryVersion(conn, xfixesMajor, xfixesMinor).Reply()
+}
+
+// OpacityAtom ウィンドウ不透明度のアトムを返す
+// アトムは普通コンポジットマネージャが定義するが、まだない場合はここで定義する
+func OpacityAtom(conn *xgb.Conn) (xproto.Atom, error) {
+	atom, err := xproto.InternAtom(conn, false, uint16(len(AtomOpacity)), AtomOpacity).Reply()
+	if err != nil {
+		return 0, err
+	}
+	return atom.Atom, nil
+}
+
+// CreateWindow override-redirectのウィンドウを作る
+// コンポジットマネージャがない場合は、spec.Fallbackに従って下が見えるよう間引く
+func (x *X11) CreateWindow(spec WindowSpec) (Window, error) {
+	conn := x.xuConn.Conn()
+	win, err := xproto.NewWindowId(conn)
+	if err != nil {
+		return 0, err
+	}
+
+	parent := xproto.Window(spec.Parent)
+	if parent == xproto.WindowNone {
+		parent = x.xuConn.RootWin()
+	}
+	r := spec.Rect
+
+	if spec.Line != nil {
+		err = x.createLineWindow(win, r, *spec.Line)
+	} else {
+		err = x.createFillWindow(win, parent, r, spec)
+	}
+	if err != nil {
+		return 0, err
+	}
+	x.res.SetOwner(uint32(win), spec.Owner)
+
+	return Window(win), nil
+}
+
+// createFillWindow 背景を塗ったウィンドウを作る
+// 作成後の設定に失敗した場合は、作ったウィンドウを破棄する
+func (x *X11) createFillWindow(win, parent xproto.Window, r Rect, spec WindowSpec) error {
+	if err := x.screen.CreateSubwindow(win, parent, r.X, r.Y, r.Width, r.Height,
+		argb.Fill{Color: spec.Color, Feather: spec.Feather}); err != nil {
+		return err
+	}
+	x.res.Add(resource.Window, uint32(win))
+
+	if !x.screen.Composited() {
+		if err := x.applyFallback(win, r.Width, r.Height, spec.Fallback); err != nil {
+			x.DestroyWindow(Window(win))
+			return err
+		}
+	}
+
+	return nil
+}
+
+// createLineWindow 線分だけを表示するウィンドウを作る
+// ARGBビジュアルでは線をアンチエイリアスして背景に描き、それ以外は線の色で塗ったウィンドウを線の形に切り抜く。
+// 作成後の設定に失敗した場合は、作ったウィンドウを破棄する
+func (x *X11) createLineWindow(win xproto.Window, r Rect, line Line) error {
+	if x.screen.ARGB() {
+		if err := x.screen.CreateLineWindow(win, r.X, r.Y, r.Width, r.Height, argb.Line{
+			X1: line.X1, Y1: line.Y1,
+			X2: line.X2, Y2: line.Y2,
+			Width: line.Width,
+			Color: line.Color,
+		}); err != nil {
+			return err
+		}
+		x.res.Add(resource.Window, uint32(win))
+		return nil
+	}
+
+	if x.shape != nil {
+		return x.shape
+	}
+	if err := x.screen.CreateWindow(win, r.X, r.Y, r.Width, r.Height, argb.Fill{Color: line.Color}); err != nil {
+		return err
+	}
+	x.res.Add(resource.Window, uint32(win))
+
+	if err := x.shapeLine(win, r, line); err != nil {
+		x.DestroyWindow(Window(win))
+		return err
+	}
+	return nil
+}
+
+// shapeLine ウィンドウを線分の形に切り抜く
+func (x *X11) shapeLine(win xproto.Window, r Rect, line Line) error {
+	mask, err := x.lineMask(win, r.Width, r.Height, line)
+	if err != nil {
+		return err
+	}
+	defer x.freePixmap(mask)
+
+	return shape.MaskChecked(x.xuConn.Conn(), shape.SoSet, shape.SkBounding, win, 0, 0, mask).Check()
+}
+
+// ConfigureWindow ウィンドウの位置と大きさを変える
+func (x *X11) ConfigureWindow(win Window, r Rect) {
+	xproto.ConfigureWindow(x.xConn, xproto.Window(win),
+		xproto.ConfigWindowX|xproto.ConfigWindowY|xproto.ConfigWindowWidth|xproto.ConfigWindowHeight,
+		[]uint32{uint32(r.X), uint32(r.Y), uint32(max(1, r.Width)), uint32(max(1, r.Height))})
+}
+
+// MapWindow ウィンドウを表示する
+func (x *X11) MapWindow(win Window) {
+	xproto.MapWindow(x.xConn, xproto.Window(win))
+}
+
+// UnmapWindow ウィンドウを隠す
+func (x *X11) UnmapWindow(win Window) {
+	xproto.UnmapWindow(x.xConn, xproto.Window(win))
+}
+
+// DestroyWindow ウィンドウを破棄する
+func (x *X11) DestroyWindow(win Window) {
+	xproto.DestroyWindow(x.xConn, xproto.Window(win))
+	x.res.Remove(uint32(win))
+}
+
+// SetShape ウィンドウの表示する部分を矩形の集まりにする
+// 応答は待たない。SHAPE拡張がない場合はエラーを返す
+func (x *X11) SetShape(win Window, rects []Rect) error {
+	if x.shape != nil {
+		return x.shape
+	}
+
+	rectangles := make([]xproto.Rectangle, len(rects))
+	for i, r := range rects {
+		rectangles[i] = xproto.Rectangle{X: int16(r.X), Y: int16(r.Y), Width: uint16(r.Width), Height: uint16(r.Height)}
+	}
+	shape.Rectangles(x.xConn, shape.SoSet, shape.SkBounding, xproto.ClipOrderingUnsorted, xproto.Window(win), 0, 0, rectangles)
+	return nil
+}
+
+// SetOpacity ウィンドウの不透明度を設定する（コンポジットマネージャが反映する）
+// コンポジットマネージャがない場合は反映されないため何もしない
+func (x *X11) SetOpacity(win Window, percent float64) error {
+	if !x.screen.Composited() {
+		return nil
+	}
+	atom, err := x.opacityAtom()
+	if err != nil {
+		return err
+	}
+
+	return xproto.ChangePropertyChecked(x.xConn, xproto.PropModeReplace, xproto.Window(win),
+		atom, xproto.AtomCardinal, 32, 1, opacityBytes(percent)).Check()
+}
+
+// SetOpacityUnchecked 応答を待たずにウィンドウの不透明度を設定する
+// Xエラーはイベントループに届く。コンポジットマネージャがない場合は何もしない
+func (x *X11) SetOpacityUnchecked(win Window, percent float64) {
+	if !x.screen.Composited() {
+		return
+	}
+	// アトムを取得できないのは接続が切れた時で、再接続で作り直される
+	atom, err := x.opacityAtom()
+	if err != nil {
+		return
+	}
+
+	xproto.ChangeProperty(x.xConn, xproto.PropModeReplace, xproto.Window(win),
+		atom, xproto.AtomCardinal, 32, 1, opacityBytes(percent))
+}
+
+// opacityAtom 不透明度のアトムを返す（一度取得したら覚えておく）
+func (x *X11) opacityAtom() (xproto.Atom, error) {
+	if x.opacity == xproto.AtomNone {
+		atom, err := OpacityAtom(x.xConn)
+		if err != nil {
+			return 0, err
+		}
+		x.opacity = atom
+	}
+	return x.opacity, nil
+}
+
+// opacityBytes 不透明度（パーセント: 0-100）をプロパティの値にする
+func opacityBytes(percent float64) []byte {
+	maxOpacity := float64(uint32(0xFFFFFFFF))
+	opacity := percent / 100.0 * maxOpacity
+	opacityValue := uint32(opacity)
+
+	return []byte{
+		byte(opacityValue & 0xFF),
+		byte((opacityValue >> 8) & 0xFF),
+		byte((opacityValue >> 16) & 0xFF),
+		byte((opacityValue >> 24) & 0xFF),
+	}
+}
+
+// SetClickThrough ウィンドウの入力領域を空にして、クリックが下のウィンドウに届くようにする
+// XFixes拡張がない場合は何もしない
+func (x *X11) SetClickThrough(win Window) error {
+	if _, err := InitXFixes(x.xConn); err != nil {
+		if errors.Is(err, ErrNoExtension) {
+			// クリックスルーなしで動かす
+			return nil
+		}
+		return err
+	}
+
+	region, err := xfixes.NewRegionId(x.xConn)
+	if err != nil {
+		return err
+	}
+	if err := xfixes.CreateRegionChecked(x.xConn, region, []xproto.Rectangle{{}}).Check(); err != nil {
+		return err
+	}
+	x.res.Add(resource.Region, uint32(region))
+	defer func() {
+		xfixes.DestroyRegion(x.xConn, region)
+		x.res.Remove(uint32(region))
+	}()
+
+	return xfixes.SetWindowShapeRegionChecked(x.xConn, xproto.Window(win), shape.SkInput, 0, 0, region).Check()
+}
+
+// QueryPointer カーソル位置を返す
+// 応答がなければ接続が切れたとみなし、abandonで待っている処理をすべてエラーで戻す
+func (x *X11) QueryPointer() (int, int, error) {
+	root := xproto.Setup(x.xConn).DefaultScreen(x.xConn).Root
+
+	cookie := xproto.QueryPointer(x.xConn, root)
+	if x.abandon != nil {
+		timer := time.AfterFunc(replyTimeout, x.abandon)
+		defer timer.Stop()
+	}
+	reply, err := cookie.Reply()
+	if err != nil {
+		return -1, -1, err
+	}
+
+	return int(reply.RootX), int(reply.RootY), nil
+}
+
+// GrabKey ルートウィンドウでキーをグラブし、押されたらfnを呼ぶ
+// fnはXのイベントループで呼ばれるため、すぐに戻ること
+func (x *X11) GrabKey(key string, fn func()) error {
+	return keybind.KeyPressFun(
+		func(X *xgbutil.XUtil, e xevent.KeyPressEvent) {
+			fn()
+		}).Connect(x.xuConn, x.xuConn.RootWin(), key, true)
+}
+
+// UngrabKeys ルートウィンドウで割り当てたキーをすべて解除する
+func (x *X11) UngrabKeys() {
+	keybind.Detach(x.xuConn, x.xuConn.RootWin())
+}
+
+// Flush 送ったリクエストが処理されるのを待つ
+func (x *X11) Flush() {
+	x.xConn.Sync()
+}
@@ -2,49 +2,268 @@ package cli
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
 
+	"github.com/kijimaD/xruler/internal/config"
+	"github.com/kijimaD/xruler/internal/control"
 	"github.com/kijimaD/xruler/internal/ruler"
+	"github.com/kijimaD/xruler/internal/xconn"
 	"github.com/urfave/cli/v3"
 )
 
+const (
+	categoryRuler = "ルーラーモード"
+	categoryHide  = "隠すモード"
+	categoryTrail = "軌跡"
+)
+
 // NewCommand は xruler の CLI コマンドを作成する
 func NewCommand() *cli.Command {
+	def := config.Default()
+
 	return &cli.Command{
 		Name:  "xruler",
 		Usage: "X Window System上でカーソル位置を追従する水平ルーラー",
 		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Name:  "display",
+				Usage: "接続するXサーバーと画面: `DISPLAY` (デフォルト: $DISPLAY、ctl のコマンドは同じ画面のxrulerを操作する)",
+			},
 			&cli.StringFlag{
 				Name:    "mode",
 				Aliases: []string{"m"},
 				Value:   "ruler",
 				Usage:   "動作モード: `MODE` (ruler または hide)",
 			},
+			&cli.StringFlag{
+				Name:      "config",
+				Aliases:   []string{"c"},
+				Usage:     "設定ファイルのパス: `FILE` (デフォルト: $XDG_CONFIG_HOME/xruler/config.json)",
+				TakesFile: true,
+			},
+			&cli.StringFlag{
+				Name:    "profile",
+				Aliases: []string{"p"},
+				Usage:   "使用するプロファイル: `NAME` (指定するとアクティブウィンドウによる自動切り替えを行わない)",
+			},
+			&cli.StringSliceFlag{
+				Name:  "bind",
+				Usage: "キーにアクションを割り当てる: `KEY=ACTION` (複数指定可、ACTION: " + strings.Join(ruler.Actions(), ", ") + ", none)",
+			},
+			&cli.FloatFlag{
+				Name:        "opacity",
+				DefaultText: "ruler: 50, hide: 100",
+				Usage:       "選択したモードの不透明度: `PERCENT` (0-100)",
+			},
+			&cli.IntFlag{
+				Name:     "ruler-height",
+				Value:    def.Ruler.Height,
+				Category: categoryRuler,
+				Usage:    "ルーラーの高さ: `PIXELS`",
+			},
+			&cli.StringFlag{
+				Name:     "ruler-color",
+				Value:    def.Ruler.Color.String(),
+				Category: categoryRuler,
+				Usage:    "ルーラーの色: `#RRGGBB`",
+			},
+			&cli.IntFlag{
+				Name:     "ruler-feather",
+				Value:    def.Ruler.Feather,
+				Category: categoryRuler,
+				Usage:    "ルーラーの上下の端をぼかす幅（コンポジット環境のみ）: `PIXELS`",
+			},
+			&cli.StringFlag{
+				Name:     "ruler-fallback",
+				Value:    def.Ruler.Fallback,
+				Category: categoryRuler,
+				Usage:    "コンポジットマネージャがない時のルーラーの描き方: `solid|stipple|outline`",
+			},
+			&cli.BoolWithInverseFlag{
+				Name:     "ruler-trail",
+				Category: categoryRuler,
+				Value:    def.Ruler.Trail,
+				Usage:    "ルーラーモードでカーソルの軌跡を表示する",
+			},
+			&cli.IntFlag{
+				Name:     "hide-height",
+				Value:    def.Hide.HideHeight,
+				Category: categoryHide,
+				Usage:    "カーソル上下の隠す領域の高さ: `PIXELS`",
+			},
+			&cli.IntFlag{
+				Name:     "hide-width",
+				Value:    def.Hide.HideWidth,
+				Category: categoryHide,
+				Usage:    "カーソル左側の隠す領域の幅: `PIXELS`",
+			},
+			&cli.IntFlag{
+				Name:     "cursor-height",
+				Value:    def.Hide.CursorHeight,
+				Category: categoryHide,
+				Usage:    "カーソル領域の高さ: `PIXELS`",
+			},
+			&cli.IntFlag{
+				Name:     "border-height",
+				Value:    def.Hide.BorderHeight,
+				Category: categoryHide,
+				Usage:    "枠線の高さ: `PIXELS`",
+			},
+			&cli.StringFlag{
+				Name:     "overlay-color",
+				Value:    def.Hide.OverlayColor.String(),
+				Category: categoryHide,
+				Usage:    "オーバーレイの色: `#RRGGBB`",
+			},
+			&cli.StringFlag{
+				Name:     "border-color",
+				Value:    def.Hide.BorderColor.String(),
+				Category: categoryHide,
+				Usage:    "枠線の色: `#RRGGBB`",
+			},
+			&cli.BoolWithInverseFlag{
+				Name:     "hide-trail",
+				Category: categoryHide,
+				Value:    def.Hide.Trail,
+				Usage:    "隠すモードでカーソルの軌跡を表示する",
+			},
+			&cli.BoolWithInverseFlag{
+				Name:     "trail",
+				Category: categoryTrail,
+				Value:    true,
+				Usage:    "カーソルの軌跡を表示する",
+			},
+			&cli.DurationFlag{
+				Name:     "trail-duration",
+				Value:    time.Duration(def.Trail.Duration),
+				Category: categoryTrail,
+				Usage:    "軌跡の表示時間: `DURATION` (例: 2s)",
+			},
+			&cli.StringFlag{
+				Name:     "trail-fade",
+				Value:    def.Trail.Fade,
+				Category: categoryTrail,
+				Usage:    "軌跡が消えていく変化の仕方: `none|linear|ease-in|ease-out|ease-in-out`",
+			},
 		},
-		Action: run,
+		Commands: append(controlCommands(), doctorCommand()),
+		Before:   useDisplay,
+		Action:   run,
 	}
 }
 
+// useDisplay --display を指定した場合は、Xサーバーへの接続先としてDISPLAYを差し替える
+func useDisplay(ctx context.Context, cmd *cli.Command) (context.Context, error) {
+	if cmd.IsSet("display") {
+		if err := os.Setenv("DISPLAY", cmd.String("display")); err != nil {
+			return ctx, err
+		}
+	}
+	return ctx, nil
+}
+
 // run は CLI コマンドのアクション関数
 func run(ctx context.Context, cmd *cli.Command) error {
-	modeStr := cmd.String("mode")
+	cfg, err := loadConfig(cmd)
+	if err != nil {
+		return cli.Exit("Error: "+err.Error(), 1)
+	}
 
-	var mode ruler.Mode
-	switch modeStr {
-	case "hide":
-		mode = ruler.DefaultHideModeConfig()
-	case "ruler":
-		mode = ruler.DefaultRulerModeConfig()
-	default:
-		return cli.Exit("Error: Invalid mode '"+modeStr+"'. Use 'hide' or 'ruler'.", 1)
+	switcher := newProfileSwitcher(cfg, cmd.String("profile"))
+	settings, ok := switcher.settings()
+	if !ok {
+		return cli.Exit("Error: プロファイル '"+cmd.String("profile")+"' は定義されていません", 1)
 	}
 
-	r := ruler.New(mode)
+	modes, err := settings.NewModes()
+	if err != nil {
+		return fmt.Errorf("モードを作成できません: %w", err)
+	}
+
+	r := ruler.New(modes, settings.TrailSettings())
 	defer r.Close()
 
-	if err := r.Init(); err != nil {
+	if err := r.Init(ctx); err != nil {
+		if errors.Is(err, ruler.ErrAlreadyRunning) {
+			return forward(cmd, r)
+		}
 		return err
 	}
 
-	r.Run()
+	if err := r.BindKeys(cfg.Keys); err != nil {
+		log.Printf("一部のキーを割り当てられませんでした: %v", err)
+	}
+
+	switcher.attach(r)
+	if !cmd.IsSet("profile") && len(cfg.Rules) > 0 {
+		if err := r.WatchActiveWindow(switcher.setWindow); err != nil {
+			log.Printf("アクティブウィンドウを監視できません: %v", err)
+		}
+	}
+
+	// SIGINT/SIGTERMで作成したウィンドウなどを片付けてから終了する
+	ctx, stop := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	go watchReload(ctx, cmd, switcher)
+
+	srv, err := listenControl(r)
+	if err != nil {
+		log.Printf("制御ソケットを開けません: %v", err)
+	} else {
+		defer srv.Close()
+		go srv.Serve()
+	}
+
+	return r.Run(ctx)
+}
+
+// listenControl 接続した画面の制御ソケットで待ち受ける
+func listenControl(r *ruler.Ruler) (*control.Server, error) {
+	display, err := xconn.DisplayID("")
+	if err != nil {
+		return nil, err
+	}
+	return control.Listen(control.SocketPath(display), r.Exec)
+}
+
+// forward 起動中のxrulerにこの起動の意図を転送する
+// --mode を指定した場合はモードの切り替え、それ以外は表示の切り替えになる
+func forward(cmd *cli.Command, r *ruler.Ruler) error {
+	args := []string{ruler.ActionToggle}
+	if cmd.IsSet("mode") {
+		args = []string{"mode", cmd.String("mode")}
+	}
+
+	if err := r.Forward(args); err != nil {
+		return cli.Exit("Error: 起動中のxrulerへの転送に失敗しました: "+err.Error(), 1)
+	}
+
+	log.Printf("xrulerは既に起動しているため、コマンドを転送しました: %s", strings.Join(args, " "))
 	return nil
 }
+
+// loadConfig 設定ファイルを読み込み、フラグで上書きする
+func loadConfig(cmd *cli.Command) (*config.Config, error) {
+	cfg, err := config.Load(cmd.String("config"))
+	if err != nil {
+		return nil, fmt.Errorf("設定ファイルの読み込みに失敗しました: %w", err)
+	}
+
+	if cmd.IsSet("mode") {
+		cfg.Mode = cmd.String("mode")
+	}
+
+	if err := applyFlags(cmd, cfg); err != nil {
+		return nil, err
+	}
+
+	return cfg, nil
+}
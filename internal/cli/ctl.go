@@ -0,0 +1,105 @@
+package cli
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/kijimaD/xruler/internal/control"
+	"github.com/kijimaD/xruler/internal/ruler"
+	"github.com/kijimaD/xruler/internal/xconn"
+	"github.com/urfave/cli/v3"
+)
+
+// actionUsages アクションのサブコマンドの説明
+var actionUsages = map[string]string{
+	ruler.ActionToggle:      "表示・非表示を切り替える",
+	ruler.ActionNextMode:    "次のモードへ切り替える",
+	ruler.ActionGrow:        "高さを増やす",
+	ruler.ActionShrink:      "高さを減らす",
+	ruler.ActionOpacityUp:   "不透明度を上げる",
+	ruler.ActionOpacityDown: "不透明度を下げる",
+	ruler.ActionPin:         "カーソルへの追従を止める・再開する",
+	ruler.ActionClearTrail:  "軌跡を消す",
+	ruler.ActionQuit:        "終了する",
+}
+
+// controlCommands 実行中のxrulerを制御ソケット経由で操作するサブコマンドを作成する
+func controlCommands() []*cli.Command {
+	commands := []*cli.Command{
+		{
+			Name:      "ctl",
+			Usage:     "実行中のxrulerにコマンドを送り、結果を表示する",
+			ArgsUsage: "COMMAND [ARGS...]",
+			Action:    sendCommand(nil, true),
+		},
+		{
+			Name:   "status",
+			Usage:  "実行中のxrulerの状態を表示する",
+			Action: sendCommand([]string{"status"}, true),
+		},
+		{
+			Name:   "resources",
+			Usage:  "実行中のxrulerが解放していないX資源の数を表示する",
+			Action: sendCommand([]string{"resources"}, true),
+		},
+		{
+			Name:   "errors",
+			Usage:  "実行中のxrulerで起きたXエラーの数をサブシステムごとに表示する",
+			Action: sendCommand([]string{"errors"}, true),
+		},
+		{
+			Name:      "mode",
+			Usage:     "モードを切り替える",
+			ArgsUsage: "NAME",
+			Action:    sendCommand([]string{"mode"}, false),
+		},
+		{
+			Name:      "set",
+			Usage:     "設定を変える (KEY: opacity, visible, pinned)",
+			ArgsUsage: "KEY VALUE",
+			Action:    sendCommand([]string{"set"}, false),
+		},
+	}
+
+	for _, action := range ruler.Actions() {
+		commands = append(commands, &cli.Command{
+			Name:   action,
+			Usage:  actionUsages[action],
+			Action: sendCommand([]string{action}, false),
+		})
+	}
+
+	return commands
+}
+
+// sendCommand コマンドを制御ソケットへ送るアクション関数を返す
+// prefixの後ろにサブコマンドの引数を付けて送り、printがtrueなら結果を表示する
+func sendCommand(prefix []string, print bool) cli.ActionFunc {
+	return func(ctx context.Context, cmd *cli.Command) error {
+		args := append(append([]string{}, prefix...), cmd.Args().Slice()...)
+		if len(args) == 0 {
+			return cli.Exit("Error: コマンドを指定してください", 1)
+		}
+
+		display, err := xconn.DisplayID(cmd.String("display"))
+		if err != nil {
+			return cli.Exit("Error: "+err.Error(), 1)
+		}
+		result, err := control.Send(control.SocketPath(display), args...)
+		if err != nil {
+			return cli.Exit("Error: "+err.Error(), 1)
+		}
+
+		if print {
+			var buf bytes.Buffer
+			if err := json.Indent(&buf, result, "", "  "); err != nil {
+				return err
+			}
+			fmt.Fprintln(cmd.Root().Writer, buf.String())
+		}
+
+		return nil
+	}
+}
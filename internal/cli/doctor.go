@@ -0,0 +1,50 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/kijimaD/xruler/internal/ruler"
+	"github.com/urfave/cli/v3"
+)
+
+// statusLabels 診断結果の表示
+var statusLabels = map[ruler.CheckStatus]string{
+	ruler.CheckOK:   "[ OK ]",
+	ruler.CheckWarn: "[WARN]",
+	ruler.CheckFail: "[FAIL]",
+}
+
+// doctorCommand Xサーバーの環境を診断するサブコマンドを作成する
+func doctorCommand() *cli.Command {
+	return &cli.Command{
+		Name:   "doctor",
+		Usage:  "Xサーバーの環境を診断し、問題があれば対処法を表示する",
+		Action: doctor,
+	}
+}
+
+// doctor 診断結果を表示する（起動できない問題があれば終了コード1で終わる）
+func doctor(ctx context.Context, cmd *cli.Command) error {
+	cfg, err := loadConfig(cmd)
+	if err != nil {
+		return cli.Exit("Error: "+err.Error(), 1)
+	}
+
+	w := cmd.Root().Writer
+	failed := false
+	for _, check := range ruler.Diagnose(cfg.Keys) {
+		fmt.Fprintf(w, "%s %s: %s\n", statusLabels[check.Status], check.Name, check.Detail)
+		if check.Hint != "" {
+			fmt.Fprintf(w, "       → %s\n", check.Hint)
+		}
+		if check.Status == ruler.CheckFail {
+			failed = true
+		}
+	}
+
+	if failed {
+		return cli.Exit("", 1)
+	}
+	return nil
+}
@@ -0,0 +1,104 @@
+package cli
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/kijimaD/xruler/internal/config"
+	"github.com/urfave/cli/v3"
+)
+
+// applyFlags 指定されたフラグで設定を上書きし、検証する
+// フラグはデフォルト値と設定ファイルの両方より優先され、すべてのプロファイルに適用される
+func applyFlags(cmd *cli.Command, cfg *config.Config) error {
+	if err := applySettingsFlags(cmd, &cfg.Settings); err != nil {
+		return err
+	}
+	for _, s := range cfg.Profiles {
+		if err := applySettingsFlags(cmd, s); err != nil {
+			return err
+		}
+	}
+
+	for _, bind := range cmd.StringSlice("bind") {
+		key, action, ok := strings.Cut(bind, "=")
+		if !ok || key == "" {
+			return fmt.Errorf("--bind: KEY=ACTION の形式で指定してください: %q", bind)
+		}
+		cfg.Keys[key] = action
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return fmt.Errorf("不正な設定値です: %w", err)
+	}
+
+	return nil
+}
+
+// applySettingsFlags 指定されたフラグで1つのプロファイルの設定を上書きする
+func applySettingsFlags(cmd *cli.Command, cfg *config.Settings) error {
+	setInt := func(name string, dst *int) {
+		if cmd.IsSet(name) {
+			*dst = cmd.Int(name)
+		}
+	}
+	setColor := func(name string, dst *config.Color) error {
+		if !cmd.IsSet(name) {
+			return nil
+		}
+		c, err := config.ParseColor(cmd.String(name))
+		if err != nil {
+			return fmt.Errorf("--%s: %w", name, err)
+		}
+		*dst = c
+		return nil
+	}
+
+	setInt("ruler-height", &cfg.Ruler.Height)
+	setInt("ruler-feather", &cfg.Ruler.Feather)
+	if cmd.IsSet("ruler-fallback") {
+		cfg.Ruler.Fallback = cmd.String("ruler-fallback")
+	}
+	if err := setColor("ruler-color", &cfg.Ruler.Color); err != nil {
+		return err
+	}
+	if cmd.IsSet("ruler-trail") {
+		cfg.Ruler.Trail = cmd.Bool("ruler-trail")
+	}
+
+	setInt("hide-height", &cfg.Hide.HideHeight)
+	setInt("hide-width", &cfg.Hide.HideWidth)
+	setInt("cursor-height", &cfg.Hide.CursorHeight)
+	setInt("border-height", &cfg.Hide.BorderHeight)
+	if err := setColor("overlay-color", &cfg.Hide.OverlayColor); err != nil {
+		return err
+	}
+	if err := setColor("border-color", &cfg.Hide.BorderColor); err != nil {
+		return err
+	}
+	if cmd.IsSet("hide-trail") {
+		cfg.Hide.Trail = cmd.Bool("hide-trail")
+	}
+
+	// 不透明度は選択したモードにだけ適用する
+	if cmd.IsSet("opacity") {
+		switch cfg.Mode {
+		case "hide":
+			cfg.Hide.Opacity = cmd.Float("opacity")
+		default:
+			cfg.Ruler.Opacity = cmd.Float("opacity")
+		}
+	}
+
+	if cmd.IsSet("trail") {
+		cfg.Trail.Enabled = cmd.Bool("trail")
+	}
+	if cmd.IsSet("trail-duration") {
+		cfg.Trail.Duration = config.Duration(cmd.Duration("trail-duration"))
+	}
+	if cmd.IsSet("trail-fade") {
+		cfg.Trail.Fade = cmd.String("trail-fade")
+	}
+
+	return nil
+}
@@ -0,0 +1,109 @@
+package cli
+
+import (
+	"log"
+	"maps"
+	"sync"
+
+	"github.com/kijimaD/xruler/internal/config"
+	"github.com/kijimaD/xruler/internal/ruler"
+)
+
+// profileSwitcher アクティブウィンドウと設定から適用するプロファイルを決め、ルーラーに反映する
+type profileSwitcher struct {
+	mu      sync.Mutex
+	r       *ruler.Ruler
+	cfg     *config.Config
+	fixed   string           // --profile で固定されたプロファイル名（空なら自動で切り替える）
+	window  ruler.WindowInfo // 最後に検出したアクティブウィンドウ
+	current string           // 適用中のプロファイル名
+}
+
+// newProfileSwitcher プロファイル切り替えを作成
+func newProfileSwitcher(cfg *config.Config, fixed string) *profileSwitcher {
+	s := &profileSwitcher{
+		cfg:   cfg,
+		fixed: fixed,
+	}
+	s.current = s.selected()
+	return s
+}
+
+// settings 適用中のプロファイルの設定を返す
+func (s *profileSwitcher) settings() (*config.Settings, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.cfg.Profile(s.current)
+}
+
+// attach 切り替え先のルーラーを設定
+func (s *profileSwitcher) attach(r *ruler.Ruler) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.r = r
+}
+
+// setWindow アクティブウィンドウが変わった時に呼ばれ、必要ならプロファイルを切り替える
+func (s *profileSwitcher) setWindow(info ruler.WindowInfo) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.window = info
+	s.apply(false)
+}
+
+// setConfig 再読み込みした設定を反映する
+func (s *profileSwitcher) setConfig(cfg *config.Config) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	keysChanged := !maps.Equal(s.cfg.Keys, cfg.Keys)
+	s.cfg = cfg
+	s.apply(true)
+
+	if s.r != nil && keysChanged {
+		if err := s.r.BindKeys(cfg.Keys); err != nil {
+			log.Printf("一部のキーを割り当てられませんでした: %v", err)
+		}
+	}
+}
+
+// selected 現在の状況で選ぶべきプロファイル名を返す
+func (s *profileSwitcher) selected() string {
+	if s.fixed != "" {
+		return s.fixed
+	}
+	return s.cfg.Match(s.window.Instance, s.window.Class, s.window.Title)
+}
+
+// apply 選ばれたプロファイルをルーラーに反映する
+// forceがfalseの場合、プロファイルが変わっていなければ何もしない
+func (s *profileSwitcher) apply(force bool) {
+	name := s.selected()
+	if s.r == nil || (!force && name == s.current) {
+		return
+	}
+
+	settings, ok := s.cfg.Profile(name)
+	if !ok {
+		log.Printf("プロファイル %q は定義されていません", name)
+		return
+	}
+
+	modes, err := settings.NewModes()
+	if err != nil {
+		log.Printf("プロファイル %q を適用できません: %v", name, err)
+		return
+	}
+
+	// 同じプロファイルの読み直しでは実行中の変更を引き継ぎ、別のプロファイルはその最初のモードから始める
+	if name == s.current {
+		s.r.Reload(modes, settings.TrailSettings())
+		return
+	}
+	s.r.SwitchProfile(modes, settings.TrailSettings())
+	log.Printf("プロファイル切り替え: %s → %s", s.current, name)
+	s.current = name
+}
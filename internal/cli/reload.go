@@ -0,0 +1,72 @@
+package cli
+
+import (
+	"context"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/kijimaD/xruler/internal/config"
+	"github.com/urfave/cli/v3"
+)
+
+// reloadDelay 設定ファイルへの連続した書き込みをまとめるための待ち時間
+const reloadDelay = 100 * time.Millisecond
+
+// watchReload 設定ファイルの変更とSIGHUPを待ち、設定を読み込み直してルーラーに反映する
+// ctxがキャンセルされると監視を終了する
+func watchReload(ctx context.Context, cmd *cli.Command, switcher *profileSwitcher) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+
+	var changed <-chan struct{}
+	if path, err := configPath(cmd); err == nil {
+		watcher, err := config.NewWatcher(path)
+		if err != nil {
+			log.Printf("設定ファイルを監視できません（SIGHUPで再読み込みできます）: %v", err)
+		} else {
+			defer watcher.Close()
+			changed = watcher.Events()
+		}
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case _, ok := <-changed:
+			if !ok {
+				changed = nil
+				continue
+			}
+			// 保存直後の書き込みが落ち着くまで待つ
+			time.Sleep(reloadDelay)
+			reload(cmd, switcher)
+		case <-hup:
+			reload(cmd, switcher)
+		}
+	}
+}
+
+// reload 設定を読み込み直してルーラーに反映する
+// 読み込みに失敗した場合は現在の設定のまま動かし続ける
+func reload(cmd *cli.Command, switcher *profileSwitcher) {
+	cfg, err := loadConfig(cmd)
+	if err != nil {
+		log.Printf("設定の再読み込みに失敗しました: %v", err)
+		return
+	}
+
+	switcher.setConfig(cfg)
+}
+
+// configPath 読み込む設定ファイルのパスを返す
+func configPath(cmd *cli.Command) (string, error) {
+	if path := cmd.String("config"); path != "" {
+		return path, nil
+	}
+	return config.DefaultPath()
+}
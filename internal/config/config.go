@@ -0,0 +1,313 @@
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/kijimaD/xruler/internal/backend"
+	"github.com/kijimaD/xruler/internal/ruler"
+	"github.com/kijimaD/xruler/internal/trail"
+)
+
+const (
+	dirName  = "xruler"      // 設定ディレクトリ名
+	fileName = "config.json" // 設定ファイル名
+)
+
+// Config xrulerの設定
+type Config struct {
+	Settings                               // プロファイルに一致しない時の設定
+	RawProfiles map[string]json.RawMessage `json:"profiles"` // 設定ファイルに書かれたプロファイル
+	Rules       []Rule                     `json:"rules"`    // プロファイルを自動で切り替えるルール
+	Keys        map[string]string          `json:"keys"`     // キーとアクションの割り当て
+	Profiles    map[string]*Settings       `json:"-"`        // 解決済みのプロファイル
+}
+
+// Settings モードと軌跡の設定（プロファイルごとに上書きできる）
+type Settings struct {
+	Mode  string      `json:"mode"`  // 動作モード（ruler または hide）
+	Cycle []string    `json:"cycle"` // 実行中に切り替えるモードの順番
+	Ruler RulerConfig `json:"ruler"` // ルーラーモードの設定
+	Hide  HideConfig  `json:"hide"`  // 隠すモードの設定
+	Trail TrailConfig `json:"trail"` // 軌跡の設定
+}
+
+// RulerConfig ルーラーモードの設定
+type RulerConfig struct {
+	Height   int     `json:"height"`   // ルーラーの高さ（ピクセル）
+	Color    Color   `json:"color"`    // ルーラーの色
+	Feather  int     `json:"feather"`  // 上下の端をぼかす幅（ピクセル、コンポジット環境のみ）
+	Fallback string  `json:"fallback"` // コンポジットマネージャがない時の描き方（solid, stipple, outline）
+	Opacity  float64 `json:"opacity"`  // 不透明度（パーセント: 0-100）
+	Trail    bool    `json:"trail"`    // カーソルの軌跡を表示するか
+}
+
+// HideConfig 隠すモードの設定
+type HideConfig struct {
+	HideHeight   int     `json:"hide_height"`   // カーソル上下の隠す領域の高さ（ピクセル）
+	HideWidth    int     `json:"hide_width"`    // カーソル左右の隠す領域の幅（ピクセル）
+	CursorHeight int     `json:"cursor_height"` // カーソル領域の高さ（ピクセル）
+	BorderHeight int     `json:"border_height"` // 枠線の高さ（ピクセル）
+	OverlayColor Color   `json:"overlay_color"` // オーバーレイの色
+	BorderColor  Color   `json:"border_color"`  // 枠線の色
+	Opacity      float64 `json:"opacity"`       // 不透明度（パーセント: 0-100）
+	Trail        bool    `json:"trail"`         // カーソルの軌跡を表示するか
+}
+
+// TrailConfig 軌跡の設定
+type TrailConfig struct {
+	Enabled     bool     `json:"enabled"`      // 軌跡を表示するか
+	Duration    Duration `json:"duration"`     // 軌跡の表示時間
+	MinDistance int      `json:"min_distance"` // 軌跡を追加する最小移動距離（ピクセル）
+	LineWidth   int      `json:"line_width"`   // 軌跡の線の太さ
+	Color       Color    `json:"color"`        // 軌跡の色
+	Fade        string   `json:"fade"`         // 軌跡が消えていく変化の仕方（none, linear, ease-in, ease-out, ease-in-out）
+}
+
+// Default デフォルト設定を返す
+func Default() *Config {
+	rulerMode := ruler.DefaultRulerModeConfig()
+	hideMode := ruler.DefaultHideModeConfig()
+	trailConfig := trail.DefaultConfig()
+
+	return &Config{
+		Settings: Settings{
+			Mode:  "ruler",
+			Cycle: []string{"ruler", "hide"},
+			Ruler: RulerConfig{
+				Height:   rulerMode.RulerHeight,
+				Color:    Color(rulerMode.RulerColor),
+				Feather:  rulerMode.Feather,
+				Fallback: rulerMode.Fallback,
+				Opacity:  rulerMode.OpacityPercent,
+				Trail:    rulerMode.Trail,
+			},
+			Hide: HideConfig{
+				HideHeight:   hideMode.HideHeight,
+				HideWidth:    hideMode.HideWidth,
+				CursorHeight: hideMode.CursorHeight,
+				BorderHeight: hideMode.BorderHeight,
+				OverlayColor: Color(hideMode.OverlayColor),
+				BorderColor:  Color(hideMode.BorderColor),
+				Opacity:      hideMode.OpacityPercent,
+				Trail:        hideMode.Trail,
+			},
+			Trail: TrailConfig{
+				Enabled:     trailConfig.Enabled,
+				Duration:    Duration(trailConfig.Duration),
+				MinDistance: trailConfig.MinDistance,
+				LineWidth:   trailConfig.LineWidth,
+				Color:       Color(trailConfig.Color),
+				Fade:        trailConfig.Fade,
+			},
+		},
+		Keys: ruler.DefaultKeymap(),
+	}
+}
+
+// DefaultPath 設定ファイルのデフォルトパスを返す
+// $XDG_CONFIG_HOME/xruler/config.json、未設定なら ~/.config/xruler/config.json
+func DefaultPath() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, dirName, fileName), nil
+}
+
+// Load 設定ファイルを読み込む
+// pathが空の場合はデフォルトパスを使い、ファイルがなければデフォルト設定を返す
+func Load(path string) (*Config, error) {
+	explicit := path != ""
+	if !explicit {
+		var err error
+		path, err = DefaultPath()
+		if err != nil {
+			return Default(), nil
+		}
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if !explicit && errors.Is(err, os.ErrNotExist) {
+			return Default(), nil
+		}
+		return nil, err
+	}
+
+	cfg := Default()
+	if err := decode(data, cfg); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if err := cfg.resolveProfiles(); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	return cfg, nil
+}
+
+// FieldError 設定項目の値が不正であることを表すエラー
+type FieldError struct {
+	Key string // 設定項目のキー（例: ruler.height）
+	Msg string // エラー内容
+}
+
+func (e *FieldError) Error() string {
+	return e.Key + ": " + e.Msg
+}
+
+// Validate 設定値を検証
+func (c *Config) Validate() error {
+	errs := []error{c.Settings.validate("")}
+	for _, name := range c.profileNames() {
+		errs = append(errs, c.Profiles[name].validate("profiles."+name+"."))
+	}
+	errs = append(errs, c.validateRules(), c.validateKeys())
+	return errors.Join(errs...)
+}
+
+// validateKeys キーの割り当てを検証
+func (c *Config) validateKeys() error {
+	keys := make([]string, 0, len(c.Keys))
+	for key := range c.Keys {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var errs []error
+	for _, key := range keys {
+		action := c.Keys[key]
+		if action != ruler.ActionNone && !slices.Contains(ruler.Actions(), action) {
+			errs = append(errs, &FieldError{
+				Key: "keys." + key,
+				Msg: fmt.Sprintf("%q は不明なアクションです（%s, %s）", action, strings.Join(ruler.Actions(), ", "), ruler.ActionNone),
+			})
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// validate 設定値を検証（prefixはエラーに表示するキーの接頭辞）
+func (s *Settings) validate(prefix string) error {
+	var errs []error
+	check := func(ok bool, key, msg string) {
+		if !ok {
+			errs = append(errs, &FieldError{Key: prefix + key, Msg: msg})
+		}
+	}
+
+	check(validMode(s.Mode), "mode", fmt.Sprintf("%q は不正なモードです（ruler または hide）", s.Mode))
+	for i, name := range s.Cycle {
+		check(validMode(name), fmt.Sprintf("cycle[%d]", i), fmt.Sprintf("%q は不正なモードです（ruler または hide）", name))
+	}
+
+	check(s.Ruler.Height > 0, "ruler.height", "1以上を指定してください")
+	check(s.Ruler.Feather >= 0, "ruler.feather", "0以上を指定してください")
+	check(s.Ruler.Feather*2 <= s.Ruler.Height, "ruler.feather", "height の半分以下を指定してください")
+	check(slices.Contains(backend.FallbackStyles(), s.Ruler.Fallback), "ruler.fallback",
+		fmt.Sprintf("%q は不正な描き方です（%s）", s.Ruler.Fallback, strings.Join(backend.FallbackStyles(), ", ")))
+	check(s.Ruler.Opacity >= 0 && s.Ruler.Opacity <= 100, "ruler.opacity", "0から100の範囲で指定してください")
+
+	check(s.Hide.HideHeight >= 0, "hide.hide_height", "0以上を指定してください")
+	check(s.Hide.HideWidth > 0, "hide.hide_width", "1以上を指定してください")
+	check(s.Hide.CursorHeight >= 0, "hide.cursor_height", "0以上を指定してください")
+	check(s.Hide.BorderHeight >= 0, "hide.border_height", "0以上を指定してください")
+	check(s.Hide.BorderHeight*2 <= s.Hide.CursorHeight, "hide.border_height", "cursor_height の半分以下を指定してください")
+	check(s.Hide.Opacity >= 0 && s.Hide.Opacity <= 100, "hide.opacity", "0から100の範囲で指定してください")
+
+	check(s.Trail.Duration > 0, "trail.duration", "正の時間を指定してください")
+	check(s.Trail.MinDistance >= 0, "trail.min_distance", "0以上を指定してください")
+	check(s.Trail.LineWidth > 0, "trail.line_width", "1以上を指定してください")
+	check(slices.Contains(trail.FadeCurves(), s.Trail.Fade), "trail.fade",
+		fmt.Sprintf("%q は不正な変化の仕方です（%s）", s.Trail.Fade, strings.Join(trail.FadeCurves(), ", ")))
+
+	return errors.Join(errs...)
+}
+
+func validMode(name string) bool {
+	return name == "ruler" || name == "hide"
+}
+
+// NewModes 切り替え対象のモード一覧を作成
+// modeのモードを先頭に、cycleの順番でその次のモードから並べる
+func (s *Settings) NewModes() ([]ruler.Mode, error) {
+	names := []string{s.Mode}
+	start := slices.Index(s.Cycle, s.Mode)
+	for i := range s.Cycle {
+		name := s.Cycle[(start+1+i)%len(s.Cycle)]
+		if !slices.Contains(names, name) {
+			names = append(names, name)
+		}
+	}
+
+	modes := make([]ruler.Mode, 0, len(names))
+	for _, name := range names {
+		mode, err := s.NewMode(name)
+		if err != nil {
+			return nil, err
+		}
+		modes = append(modes, mode)
+	}
+
+	return modes, nil
+}
+
+// NewMode 名前に対応するモードを設定値から作成
+func (s *Settings) NewMode(name string) (ruler.Mode, error) {
+	switch name {
+	case "ruler":
+		return s.RulerMode(), nil
+	case "hide":
+		return s.HideMode(), nil
+	default:
+		return nil, &FieldError{Key: "mode", Msg: fmt.Sprintf("%q は不正なモードです（ruler または hide）", name)}
+	}
+}
+
+// RulerMode ルーラーモードの設定を返す
+func (s *Settings) RulerMode() ruler.RulerModeConfig {
+	return ruler.RulerModeConfig{
+		RulerHeight:    s.Ruler.Height,
+		RulerColor:     uint32(s.Ruler.Color),
+		Feather:        s.Ruler.Feather,
+		Fallback:       s.Ruler.Fallback,
+		OpacityPercent: s.Ruler.Opacity,
+		Trail:          s.Ruler.Trail,
+	}
+}
+
+// HideMode 隠すモードの設定を返す
+func (s *Settings) HideMode() ruler.HideModeConfig {
+	return ruler.HideModeConfig{
+		HideHeight:     s.Hide.HideHeight,
+		HideWidth:      s.Hide.HideWidth,
+		CursorHeight:   s.Hide.CursorHeight,
+		BorderHeight:   s.Hide.BorderHeight,
+		OverlayColor:   uint32(s.Hide.OverlayColor),
+		BorderColor:    uint32(s.Hide.BorderColor),
+		OpacityPercent: s.Hide.Opacity,
+		Trail:          s.Hide.Trail,
+	}
+}
+
+// TrailSettings 軌跡の設定を返す
+func (s *Settings) TrailSettings() trail.Config {
+	return trail.Config{
+		Enabled:     s.Trail.Enabled,
+		Duration:    time.Duration(s.Trail.Duration),
+		MinDistance: s.Trail.MinDistance,
+		LineWidth:   s.Trail.LineWidth,
+		Color:       uint32(s.Trail.Color),
+		Fade:        s.Trail.Fade,
+	}
+}
@@ -0,0 +1,143 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// decode JSONを設定に読み込む
+// 値が不正な場合や未知のキーがある場合は、どのキーが原因かを示すFieldErrorを返す
+func decode(data []byte, cfg *Config) error {
+	if err := json.Unmarshal(data, new(any)); err != nil {
+		var syntaxErr *json.SyntaxError
+		if errors.As(err, &syntaxErr) {
+			line, col := position(data, syntaxErr.Offset)
+			return fmt.Errorf("%d行%d列: JSONの構文エラー: %w", line, col, err)
+		}
+		return err
+	}
+
+	return decodeObject("", data, reflect.ValueOf(cfg).Elem())
+}
+
+// decodeObject JSONオブジェクトを構造体へキーごとに読み込む
+func decodeObject(prefix string, data []byte, dst reflect.Value) error {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return &FieldError{Key: keyOrRoot(prefix), Msg: "オブジェクトを指定してください"}
+	}
+
+	targets := make(map[string]reflect.Value)
+	collectFields(dst, targets)
+
+	names := make([]string, 0, len(fields))
+	for name := range fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		raw := fields[name]
+		key := joinKey(prefix, name)
+		field, ok := targets[name]
+		if !ok {
+			return &FieldError{Key: key, Msg: "不明な設定項目です"}
+		}
+
+		if isObject(field) {
+			if err := decodeObject(key, raw, field); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if field.Kind() == reflect.Slice && isObject(reflect.New(field.Type().Elem()).Elem()) {
+			if err := decodeObjects(key, raw, field); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if err := json.Unmarshal(raw, field.Addr().Interface()); err != nil {
+			var typeErr *json.UnmarshalTypeError
+			if errors.As(err, &typeErr) {
+				return &FieldError{Key: key, Msg: fmt.Sprintf("%s型の値を指定してください", typeErr.Type)}
+			}
+			return &FieldError{Key: key, Msg: err.Error()}
+		}
+	}
+
+	return nil
+}
+
+// decodeObjects JSONオブジェクトの配列を構造体のスライスへ要素ごとに読み込む
+func decodeObjects(key string, data []byte, dst reflect.Value) error {
+	var items []json.RawMessage
+	if err := json.Unmarshal(data, &items); err != nil {
+		return &FieldError{Key: key, Msg: "配列を指定してください"}
+	}
+
+	slice := reflect.MakeSlice(dst.Type(), len(items), len(items))
+	for i, item := range items {
+		if err := decodeObject(fmt.Sprintf("%s[%d]", key, i), item, slice.Index(i)); err != nil {
+			return err
+		}
+	}
+	dst.Set(slice)
+
+	return nil
+}
+
+// collectFields 構造体のフィールドをJSONのキーごとに集める
+// 埋め込まれた構造体のフィールドは親のキーとして扱う
+func collectFields(v reflect.Value, targets map[string]reflect.Value) {
+	for i := 0; i < v.NumField(); i++ {
+		field := v.Type().Field(i)
+		if field.Anonymous && field.Type.Kind() == reflect.Struct {
+			collectFields(v.Field(i), targets)
+			continue
+		}
+
+		name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if name == "" || name == "-" {
+			continue
+		}
+		targets[name] = v.Field(i)
+	}
+}
+
+// isObject 値がキーごとに読み込む対象の構造体かを返す
+func isObject(v reflect.Value) bool {
+	if v.Kind() != reflect.Struct {
+		return false
+	}
+	_, custom := v.Addr().Interface().(json.Unmarshaler)
+	return !custom
+}
+
+func joinKey(prefix, name string) string {
+	if prefix == "" {
+		return name
+	}
+	return prefix + "." + name
+}
+
+func keyOrRoot(key string) string {
+	if key == "" {
+		return "(root)"
+	}
+	return key
+}
+
+// position バイトオフセットを行と列に変換
+func position(data []byte, offset int64) (int, int) {
+	before := data[:min(int(offset), len(data))]
+	line := bytes.Count(before, []byte("\n")) + 1
+	col := len(before) - bytes.LastIndexByte(before, '\n')
+	return line, col
+}
@@ -0,0 +1,88 @@
+package config
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDecodeFieldError(t *testing.T) {
+	tests := []struct {
+		name string
+		json string
+		key  string
+	}{
+		{name: "不明なキー", json: `{"hide": {"border_colour": "#000000"}}`, key: "hide.border_colour"},
+		{name: "不明な最上位のキー", json: `{"rulers": {}}`, key: "rulers"},
+		{name: "色の型が違う", json: `{"hide": {"border_color": 123}}`, key: "hide.border_color"},
+		{name: "色の形式が違う", json: `{"hide": {"border_color": "#fff"}}`, key: "hide.border_color"},
+		{name: "数値の型が違う", json: `{"ruler": {"height": "tall"}}`, key: "ruler.height"},
+		{name: "時間の形式が違う", json: `{"trail": {"duration": "soon"}}`, key: "trail.duration"},
+		{name: "オブジェクトでない", json: `{"ruler": 5}`, key: "ruler"},
+		{name: "配列の要素", json: `{"rules": [{"class": "a"}, {"class": 1}]}`, key: "rules[1].class"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := decode([]byte(tt.json), Default())
+
+			var fieldErr *FieldError
+			if !errors.As(err, &fieldErr) {
+				t.Fatalf("err = %v, want FieldError", err)
+			}
+			if fieldErr.Key != tt.key {
+				t.Errorf("キー = %q, want %q（%v）", fieldErr.Key, tt.key, err)
+			}
+		})
+	}
+}
+
+func TestDecodeSyntaxError(t *testing.T) {
+	err := decode([]byte("{\n  \"mode\": \n}"), Default())
+	if err == nil || !strings.Contains(err.Error(), "3行") {
+		t.Errorf("err = %v, want 構文エラーの行番号", err)
+	}
+}
+
+func TestDecodeKeepsDefaults(t *testing.T) {
+	cfg := Default()
+	data := `{
+		"hide": {"border_color": "#112233"},
+		"trail": {"duration": "500ms"},
+		"rules": [{"class": "zathura", "profile": "reading"}]
+	}`
+	if err := decode([]byte(data), cfg); err != nil {
+		t.Fatal(err)
+	}
+
+	want := Default()
+	want.Hide.BorderColor = 0x112233
+	want.Trail.Duration = Duration(500 * time.Millisecond)
+	want.Rules = []Rule{{Class: "zathura", Profile: "reading"}}
+	if !reflect.DeepEqual(cfg, want) {
+		t.Errorf("設定 = %+v, want %+v", cfg, want)
+	}
+}
+
+func TestLoad(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.json")
+	if err := os.WriteFile(path, []byte(`{"ruler": {"height": 0}}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	// 読み込んだ値も検証する
+	_, err := Load(path)
+	var fieldErr *FieldError
+	if !errors.As(err, &fieldErr) || fieldErr.Key != "ruler.height" {
+		t.Errorf("err = %v, want ruler.height のFieldError", err)
+	}
+
+	// 明示したファイルがなければエラーにする
+	if _, err := Load(filepath.Join(t.TempDir(), "none.json")); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("err = %v, want ErrNotExist", err)
+	}
+}
@@ -0,0 +1,110 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// DefaultProfile どのルールにも一致しない時に使うプロファイル名
+const DefaultProfile = "default"
+
+// Rule アクティブウィンドウに応じてプロファイルを選ぶルール
+// 指定した条件がすべて一致した時にプロファイルが適用される。パターンは大文字小文字を区別しないglob
+type Rule struct {
+	Class   string `json:"class"`   // WM_CLASSのインスタンス名またはクラス名のパターン
+	Title   string `json:"title"`   // ウィンドウタイトル（_NET_WM_NAME）のパターン
+	Profile string `json:"profile"` // 適用するプロファイル名
+}
+
+// Match ウィンドウがルールに一致するかを返す
+func (r Rule) Match(instance, class, title string) bool {
+	if r.Class == "" && r.Title == "" {
+		return false
+	}
+	if r.Class != "" && !globMatch(r.Class, instance) && !globMatch(r.Class, class) {
+		return false
+	}
+	if r.Title != "" && !globMatch(r.Title, title) {
+		return false
+	}
+	return true
+}
+
+func globMatch(pattern, s string) bool {
+	ok, err := path.Match(strings.ToLower(pattern), strings.ToLower(s))
+	return err == nil && ok
+}
+
+// Profile 名前に対応するプロファイルの設定を返す
+func (c *Config) Profile(name string) (*Settings, bool) {
+	if name == DefaultProfile {
+		return &c.Settings, true
+	}
+	s, ok := c.Profiles[name]
+	return s, ok
+}
+
+// Match アクティブウィンドウに一致する最初のルールのプロファイル名を返す
+// 一致するルールがなければ DefaultProfile を返す
+func (c *Config) Match(instance, class, title string) string {
+	for _, rule := range c.Rules {
+		if rule.Match(instance, class, title) {
+			return rule.Profile
+		}
+	}
+	return DefaultProfile
+}
+
+// resolveProfiles 設定ファイルのプロファイルを基本設定に重ねて解決する
+// プロファイルには mode, ruler, hide, trail のうち変えたい項目だけを書けばよい
+func (c *Config) resolveProfiles() error {
+	c.Profiles = make(map[string]*Settings, len(c.RawProfiles))
+	for name, raw := range c.RawProfiles {
+		key := "profiles." + name
+		if name == DefaultProfile {
+			return &FieldError{Key: key, Msg: fmt.Sprintf("%q は予約されたプロファイル名です", DefaultProfile)}
+		}
+
+		s := c.Settings
+		if err := decodeObject(key, raw, reflect.ValueOf(&s).Elem()); err != nil {
+			return err
+		}
+		c.Profiles[name] = &s
+	}
+	return nil
+}
+
+// profileNames プロファイル名を名前順で返す
+func (c *Config) profileNames() []string {
+	names := make([]string, 0, len(c.Profiles))
+	for name := range c.Profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// validateRules ルールを検証
+func (c *Config) validateRules() error {
+	var errs []error
+	for i, rule := range c.Rules {
+		key := fmt.Sprintf("rules[%d]", i)
+		if rule.Class == "" && rule.Title == "" {
+			errs = append(errs, &FieldError{Key: key, Msg: "class または title を指定してください"})
+		}
+		if _, err := path.Match(rule.Class, ""); err != nil {
+			errs = append(errs, &FieldError{Key: key + ".class", Msg: fmt.Sprintf("不正なパターンです: %q", rule.Class)})
+		}
+		if _, err := path.Match(rule.Title, ""); err != nil {
+			errs = append(errs, &FieldError{Key: key + ".title", Msg: fmt.Sprintf("不正なパターンです: %q", rule.Title)})
+		}
+		if _, ok := c.Profile(rule.Profile); !ok {
+			errs = append(errs, &FieldError{Key: key + ".profile", Msg: fmt.Sprintf("プロファイル %q は定義されていません", rule.Profile)})
+		}
+	}
+	return errors.Join(errs...)
+}
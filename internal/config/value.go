@@ -0,0 +1,76 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Color "#rrggbb" 形式で表す色
+type Color uint32
+
+// String 色を "#rrggbb" 形式で返す
+func (c Color) String() string {
+	return fmt.Sprintf("#%06x", uint32(c))
+}
+
+// ParseColor "#rrggbb" または "0xrrggbb" 形式の文字列を色に変換
+func ParseColor(s string) (Color, error) {
+	hex := strings.TrimPrefix(strings.TrimPrefix(strings.ToLower(s), "#"), "0x")
+	if len(hex) != 6 {
+		return 0, fmt.Errorf("色は \"#rrggbb\" 形式で指定してください: %q", s)
+	}
+	v, err := strconv.ParseUint(hex, 16, 32)
+	if err != nil {
+		return 0, fmt.Errorf("色は \"#rrggbb\" 形式で指定してください: %q", s)
+	}
+	return Color(v), nil
+}
+
+// MarshalJSON 色を文字列として書き出す
+func (c Color) MarshalJSON() ([]byte, error) {
+	return json.Marshal(c.String())
+}
+
+// UnmarshalJSON "#rrggbb" 形式の文字列から色を読み込む
+func (c *Color) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return fmt.Errorf("色は文字列で指定してください: %s", data)
+	}
+	v, err := ParseColor(s)
+	if err != nil {
+		return err
+	}
+	*c = v
+	return nil
+}
+
+// Duration "2s" や "500ms" 形式で表す時間
+type Duration time.Duration
+
+// String 時間を文字列で返す
+func (d Duration) String() string {
+	return time.Duration(d).String()
+}
+
+// MarshalJSON 時間を文字列として書き出す
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(d.String())
+}
+
+// UnmarshalJSON "2s" 形式の文字列から時間を読み込む
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return fmt.Errorf("時間は \"2s\" のような文字列で指定してください: %s", data)
+	}
+	v, err := time.ParseDuration(s)
+	if err != nil {
+		return fmt.Errorf("時間は \"2s\" のような文字列で指定してください: %q", s)
+	}
+	*d = Duration(v)
+	return nil
+}
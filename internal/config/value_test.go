@@ -0,0 +1,61 @@
+package config
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestParseColor(t *testing.T) {
+	tests := []struct {
+		s    string
+		want Color
+		ok   bool
+	}{
+		{s: "#ff8000", want: 0xff8000, ok: true},
+		{s: "#FF8000", want: 0xff8000, ok: true},
+		{s: "0xff8000", want: 0xff8000, ok: true},
+		{s: "ff8000", want: 0xff8000, ok: true},
+		{s: "#fff"},
+		{s: "#gg0000"},
+		{s: ""},
+	}
+
+	for _, tt := range tests {
+		got, err := ParseColor(tt.s)
+		if (err == nil) != tt.ok || got != tt.want {
+			t.Errorf("ParseColor(%q) = %v, %v, want %v (ok=%v)", tt.s, got, err, tt.want, tt.ok)
+		}
+	}
+
+	if got := Color(0x0a0b0c).String(); got != "#0a0b0c" {
+		t.Errorf("String() = %q, want #0a0b0c", got)
+	}
+}
+
+func TestDurationJSON(t *testing.T) {
+	tests := []struct {
+		json string
+		want Duration
+		ok   bool
+	}{
+		{json: `"2s"`, want: Duration(2 * time.Second), ok: true},
+		{json: `"1.5s"`, want: Duration(1500 * time.Millisecond), ok: true},
+		{json: `"500ms"`, want: Duration(500 * time.Millisecond), ok: true},
+		{json: `2`},
+		{json: `"2"`},
+	}
+
+	for _, tt := range tests {
+		var got Duration
+		err := json.Unmarshal([]byte(tt.json), &got)
+		if (err == nil) != tt.ok || got != tt.want {
+			t.Errorf("Unmarshal(%s) = %v, %v, want %v (ok=%v)", tt.json, got, err, tt.want, tt.ok)
+		}
+	}
+
+	data, err := json.Marshal(Duration(2 * time.Second))
+	if err != nil || string(data) != `"2s"` {
+		t.Errorf("Marshal = %s, %v, want \"2s\"", data, err)
+	}
+}
@@ -0,0 +1,87 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"syscall"
+	"unsafe"
+)
+
+// watchMask 設定ファイルの書き込み完了・置き換え・作成を検出するinotifyマスク
+// エディタは一時ファイルからのリネームで保存することが多いため、ファイルではなくディレクトリを監視する
+const watchMask = syscall.IN_CLOSE_WRITE | syscall.IN_MOVED_TO | syscall.IN_CREATE
+
+// Watcher 設定ファイルの変更を監視する
+type Watcher struct {
+	file   *os.File
+	events chan struct{}
+}
+
+// NewWatcher inotifyで設定ファイルの監視を開始
+func NewWatcher(path string) (*Watcher, error) {
+	fd, err := syscall.InotifyInit1(syscall.IN_CLOEXEC | syscall.IN_NONBLOCK)
+	if err != nil {
+		return nil, os.NewSyscallError("inotify_init1", err)
+	}
+
+	if _, err := syscall.InotifyAddWatch(fd, filepath.Dir(path), watchMask); err != nil {
+		syscall.Close(fd)
+		return nil, os.NewSyscallError("inotify_add_watch", err)
+	}
+
+	w := &Watcher{
+		// 非ブロッキングのfdにすることでCloseで読み込みを中断できる
+		file:   os.NewFile(uintptr(fd), "inotify"),
+		events: make(chan struct{}, 1),
+	}
+	go w.loop(filepath.Base(path))
+
+	return w, nil
+}
+
+// Events 設定ファイルが変更されると通知されるチャネルを返す
+// 連続した変更は1回の通知にまとめられる
+func (w *Watcher) Events() <-chan struct{} {
+	return w.events
+}
+
+// Close 監視を終了
+func (w *Watcher) Close() error {
+	return w.file.Close()
+}
+
+func (w *Watcher) loop(name string) {
+	defer close(w.events)
+
+	buf := make([]byte, 4096)
+	for {
+		n, err := w.file.Read(buf)
+		if err != nil {
+			return
+		}
+
+		for offset := 0; offset+syscall.SizeofInotifyEvent <= n; {
+			ev := (*syscall.InotifyEvent)(unsafe.Pointer(&buf[offset]))
+			nameBytes := buf[offset+syscall.SizeofInotifyEvent : offset+syscall.SizeofInotifyEvent+int(ev.Len)]
+			offset += syscall.SizeofInotifyEvent + int(ev.Len)
+
+			if eventName(nameBytes) != name {
+				continue
+			}
+			select {
+			case w.events <- struct{}{}:
+			default:
+			}
+		}
+	}
+}
+
+// eventName NUL埋めされたinotifyイベントのファイル名を取り出す
+func eventName(b []byte) string {
+	for i, c := range b {
+		if c == 0 {
+			return string(b[:i])
+		}
+	}
+	return string(b)
+}
@@ -0,0 +1,23 @@
+//go:build !linux
+
+package config
+
+import "errors"
+
+// Watcher 設定ファイルの変更を監視する（Linux以外では未対応）
+type Watcher struct{}
+
+// NewWatcher Linux以外では監視できないためエラーを返す
+func NewWatcher(path string) (*Watcher, error) {
+	return nil, errors.ErrUnsupported
+}
+
+// Events 何も通知しないチャネルを返す
+func (w *Watcher) Events() <-chan struct{} {
+	return nil
+}
+
+// Close 何もしない
+func (w *Watcher) Close() error {
+	return nil
+}
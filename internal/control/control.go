@@ -0,0 +1,198 @@
+// Package control 実行中のxrulerを外から操作する制御ソケット
+//
+// 1行に1つのコマンドを、空白区切りの文字列かJSON（Request）で受け取り、
+// 結果を1行のJSON（Response）で返す
+package control
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+const dialTimeout = 2 * time.Second // 接続と応答のタイムアウト
+
+// Request クライアントからの要求（1行のJSON）
+type Request struct {
+	Args []string `json:"args"` // コマンドと引数（例: ["set", "opacity", "40"]）
+}
+
+// Response サーバーからの応答（1行のJSON）
+type Response struct {
+	OK     bool            `json:"ok"`               // 成功したか
+	Result json.RawMessage `json:"result,omitempty"` // コマンドの結果
+	Error  string          `json:"error,omitempty"`  // 失敗した理由
+}
+
+// Handler コマンドを実行し、結果を返す関数
+type Handler func(args []string) (any, error)
+
+// SocketPath 画面（xconn.DisplayID の文字列）ごとの制御ソケットのパスを返す
+// 画面ごとに1つ起動できるため、ソケット名に画面を含める。
+// $XDG_RUNTIME_DIR/xruler-:0.0.sock、未設定なら一時ディレクトリにユーザーごとのソケットを置く
+func SocketPath(display string) string {
+	if dir := os.Getenv("XDG_RUNTIME_DIR"); dir != "" {
+		return filepath.Join(dir, fmt.Sprintf("xruler-%s.sock", display))
+	}
+	return filepath.Join(os.TempDir(), fmt.Sprintf("xruler-%d-%s.sock", os.Getuid(), display))
+}
+
+// Server 制御ソケットのサーバー
+type Server struct {
+	listener net.Listener
+	handler  Handler
+	wg       sync.WaitGroup
+	mu       sync.Mutex
+	conns    map[net.Conn]struct{} // 接続中のクライアント
+}
+
+// Listen 制御ソケットで待ち受けを開始
+// 前回の異常終了で残ったソケットファイルは削除して作り直す
+func Listen(path string, handler Handler) (*Server, error) {
+	listener, err := net.Listen("unix", path)
+	if err != nil {
+		// 応答がなければ古いソケットとみなす
+		if conn, dialErr := net.DialTimeout("unix", path, dialTimeout); dialErr == nil {
+			conn.Close()
+			return nil, fmt.Errorf("%s は別のxrulerが使用中です", path)
+		}
+		if rmErr := os.Remove(path); rmErr != nil && !errors.Is(rmErr, os.ErrNotExist) {
+			return nil, err
+		}
+		if listener, err = net.Listen("unix", path); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := os.Chmod(path, 0o600); err != nil {
+		listener.Close()
+		return nil, err
+	}
+
+	return &Server{
+		listener: listener,
+		handler:  handler,
+		conns:    make(map[net.Conn]struct{}),
+	}, nil
+}
+
+// Serve 接続を受け付け、Closeされるまで要求を処理する
+func (s *Server) Serve() {
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			if !errors.Is(err, net.ErrClosed) {
+				log.Printf("制御ソケットエラー: %v", err)
+			}
+			return
+		}
+
+		s.mu.Lock()
+		s.conns[conn] = struct{}{}
+		s.mu.Unlock()
+
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			s.handle(conn)
+
+			s.mu.Lock()
+			delete(s.conns, conn)
+			s.mu.Unlock()
+		}()
+	}
+}
+
+// Close 待ち受けを終了し、ソケットファイルを削除する
+// 処理中の要求には応答を返してから接続を閉じる
+func (s *Server) Close() error {
+	// UnixListenerはClose時にソケットファイルを削除する
+	err := s.listener.Close()
+
+	// 次の要求を待っている接続の読み込みを打ち切る
+	s.mu.Lock()
+	for conn := range s.conns {
+		conn.SetReadDeadline(time.Now())
+	}
+	s.mu.Unlock()
+
+	s.wg.Wait()
+	return err
+}
+
+// handle 1つの接続の要求を1行ずつ処理する
+func (s *Server) handle(conn net.Conn) {
+	defer conn.Close()
+
+	scanner := bufio.NewScanner(conn)
+	encoder := json.NewEncoder(conn)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+
+		if err := encoder.Encode(s.dispatch(line)); err != nil {
+			return
+		}
+	}
+}
+
+// dispatch 1行の要求を解釈して実行する
+// JSONでない行は空白区切りのコマンドとして扱う（例: "set opacity 40"）
+func (s *Server) dispatch(line string) Response {
+	var req Request
+	if strings.HasPrefix(line, "{") {
+		if err := json.Unmarshal([]byte(line), &req); err != nil {
+			return Response{Error: "不正な要求です: " + err.Error()}
+		}
+	} else {
+		req.Args = strings.Fields(line)
+	}
+
+	result, err := s.handler(req.Args)
+	if err != nil {
+		return Response{Error: err.Error()}
+	}
+
+	data, err := json.Marshal(result)
+	if err != nil {
+		return Response{Error: err.Error()}
+	}
+	return Response{OK: true, Result: data}
+}
+
+// Send 実行中のxrulerにコマンドを送り、結果を返す
+func Send(path string, args ...string) (json.RawMessage, error) {
+	conn, err := net.DialTimeout("unix", path, dialTimeout)
+	if err != nil {
+		return nil, fmt.Errorf("xrulerに接続できません（起動していますか？）: %w", err)
+	}
+	defer conn.Close()
+
+	if err := conn.SetDeadline(time.Now().Add(dialTimeout)); err != nil {
+		return nil, err
+	}
+
+	if err := json.NewEncoder(conn).Encode(Request{Args: args}); err != nil {
+		return nil, err
+	}
+
+	var resp Response
+	if err := json.NewDecoder(conn).Decode(&resp); err != nil {
+		return nil, err
+	}
+	if !resp.OK {
+		return nil, errors.New(resp.Error)
+	}
+
+	return resp.Result, nil
+}
@@ -0,0 +1,193 @@
+package control
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// startServer 一時ディレクトリのソケットでhandlerを呼ぶサーバーを起動する
+func startServer(t *testing.T, handler Handler) (*Server, string) {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "xruler.sock")
+	s, err := Listen(path, handler)
+	if err != nil {
+		t.Fatal(err)
+	}
+	go s.Serve()
+	t.Cleanup(func() { s.Close() })
+	return s, path
+}
+
+// exchange 1行ずつ送り、それぞれの応答を返す
+func exchange(t *testing.T, path string, lines ...string) []Response {
+	t.Helper()
+
+	conn, err := net.Dial("unix", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(time.Second))
+
+	reader := bufio.NewReader(conn)
+	var responses []Response
+	for _, line := range lines {
+		if _, err := conn.Write([]byte(line + "\n")); err != nil {
+			t.Fatal(err)
+		}
+		data, err := reader.ReadBytes('\n')
+		if err != nil {
+			t.Fatal(err)
+		}
+		var resp Response
+		if err := json.Unmarshal(data, &resp); err != nil {
+			t.Fatalf("応答 %q: %v", data, err)
+		}
+		responses = append(responses, resp)
+	}
+	return responses
+}
+
+// TestDispatch 空白区切りの行とJSONの行を同じコマンドとして実行する
+func TestDispatch(t *testing.T) {
+	var got [][]string
+	_, path := startServer(t, func(args []string) (any, error) {
+		got = append(got, args)
+		return map[string]int{"n": len(args)}, nil
+	})
+
+	responses := exchange(t, path,
+		"set opacity 40",
+		`{"args": ["set", "opacity", "40"]}`,
+		"  status  ",
+	)
+
+	want := [][]string{{"set", "opacity", "40"}, {"set", "opacity", "40"}, {"status"}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("実行したコマンド = %q, want %q", got, want)
+	}
+	for i, n := range []string{`{"n":3}`, `{"n":3}`, `{"n":1}`} {
+		if !responses[i].OK || string(responses[i].Result) != n {
+			t.Errorf("応答[%d] = %+v, want ok, %s", i, responses[i], n)
+		}
+	}
+}
+
+// TestDispatchError 実行や解釈に失敗した要求には、理由を入れた応答を返す
+func TestDispatchError(t *testing.T) {
+	_, path := startServer(t, func(args []string) (any, error) {
+		return nil, errors.New("不明なコマンドです: " + args[0])
+	})
+
+	responses := exchange(t, path, "jump", `{"args": [`)
+	if responses[0].OK || responses[0].Error != "不明なコマンドです: jump" {
+		t.Errorf("実行エラーの応答 = %+v", responses[0])
+	}
+	if responses[1].OK || !strings.HasPrefix(responses[1].Error, "不正な要求です") {
+		t.Errorf("不正なJSONの応答 = %+v", responses[1])
+	}
+
+	if _, err := Send(path, "jump"); err == nil || err.Error() != "不明なコマンドです: jump" {
+		t.Errorf("Send() = %v, want 実行エラー", err)
+	}
+}
+
+// TestListenStale 前回の異常終了で残ったソケットは作り直し、使用中のソケットは奪わない
+func TestListenStale(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "xruler.sock")
+
+	// 待ち受けを終えてもファイルだけが残ったソケットを作る
+	stale, err := net.Listen("unix", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stale.(*net.UnixListener).SetUnlinkOnClose(false)
+	stale.Close()
+	if _, err := os.Stat(path); err != nil {
+		t.Fatalf("残ったソケットを作れていない: %v", err)
+	}
+
+	s, err := Listen(path, func([]string) (any, error) { return "ok", nil })
+	if err != nil {
+		t.Fatalf("残ったソケットで Listen() = %v", err)
+	}
+	go s.Serve()
+	defer s.Close()
+	if info, err := os.Stat(path); err != nil || info.Mode().Perm() != 0o600 {
+		t.Errorf("ソケットの権限 = %v, %v, want 0600", info.Mode().Perm(), err)
+	}
+
+	if _, err := Listen(path, nil); err == nil || !strings.Contains(err.Error(), "使用中") {
+		t.Errorf("使用中のソケットで Listen() = %v, want 使用中のエラー", err)
+	}
+	if result, err := Send(path, "status"); err != nil || string(result) != `"ok"` {
+		t.Errorf("Send() = %s, %v, want 元のサーバーの応答", result, err)
+	}
+}
+
+// TestCloseDrains Closeは処理中の要求に応答してから、待機中の接続も含めて閉じる
+func TestCloseDrains(t *testing.T) {
+	started := make(chan struct{})
+	release := make(chan struct{})
+	s, path := startServer(t, func(args []string) (any, error) {
+		if args[0] == "slow" {
+			close(started)
+			<-release
+		}
+		return args[0], nil
+	})
+
+	// 何も送らずに待っている接続
+	idle, err := net.Dial("unix", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer idle.Close()
+
+	// 処理中の要求がある接続
+	busy, err := net.Dial("unix", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer busy.Close()
+	busy.SetDeadline(time.Now().Add(time.Second))
+	if _, err := busy.Write([]byte("slow\n")); err != nil {
+		t.Fatal(err)
+	}
+	<-started
+
+	closed := make(chan error, 1)
+	go func() { closed <- s.Close() }()
+	close(release)
+
+	var resp Response
+	if err := json.NewDecoder(busy).Decode(&resp); err != nil || !resp.OK || string(resp.Result) != `"slow"` {
+		t.Errorf("処理中の要求の応答 = %+v, %v", resp, err)
+	}
+
+	select {
+	case err := <-closed:
+		if err != nil {
+			t.Errorf("Close() = %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Closeが接続中のクライアントを待ち続けている")
+	}
+
+	idle.SetReadDeadline(time.Now().Add(time.Second))
+	if _, err := idle.Read(make([]byte, 1)); err == nil {
+		t.Error("待機中の接続を閉じていない")
+	}
+	if _, err := os.Stat(path); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("ソケットファイルが残っている: %v", err)
+	}
+}
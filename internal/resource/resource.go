@@ -0,0 +1,147 @@
+// Package resource xrulerが作成したX資源を記録し、種類ごとの数を数える
+//
+// 解放し忘れた資源を見つけるために使う。Xサーバーとの接続が切れると
+// 資源はサーバー側で消えるため、再接続時は Reset で記録を消す
+package resource
+
+import (
+	"sort"
+	"sync"
+)
+
+// Kind X資源の種類
+type Kind string
+
+const (
+	Window   Kind = "window"   // ウィンドウ
+	Pixmap   Kind = "pixmap"   // Pixmap
+	GC       Kind = "gc"       // グラフィックコンテキスト
+	Picture  Kind = "picture"  // RENDERのPicture
+	Region   Kind = "region"   // XFixesのリージョン
+	Colormap Kind = "colormap" // カラーマップ
+)
+
+// freedHistory 解放した後も持ち主を調べられるように覚えておく資源の数
+// 解放の直前に送ったリクエストのエラーは、解放した後に届くことがある
+const freedHistory = 256
+
+// entry 記録した資源
+type entry struct {
+	id    uint32
+	kind  Kind
+	owner string // 資源を使うサブシステム（空なら不明）
+}
+
+// Tracker 作成したX資源をIDで記録する
+// nilのTrackerは何も記録しない
+type Tracker struct {
+	mu    sync.Mutex
+	live  map[uint32]entry // 解放していない資源
+	freed []entry          // 最近解放した資源（古い順）
+}
+
+// NewTracker 資源の記録を始める
+func NewTracker() *Tracker {
+	return &Tracker{live: make(map[uint32]entry)}
+}
+
+// Add 作成した資源を記録する
+func (t *Tracker) Add(kind Kind, id uint32) {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.live[id] = entry{id: id, kind: kind}
+}
+
+// SetOwner 記録した資源を使うサブシステムの名前を付ける
+func (t *Tracker) SetOwner(id uint32, owner string) {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if e, ok := t.live[id]; ok {
+		e.owner = owner
+		t.live[id] = e
+	}
+}
+
+// Remove 解放した資源を記録から消す
+func (t *Tracker) Remove(id uint32) {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	e, ok := t.live[id]
+	if !ok {
+		return
+	}
+	delete(t.live, id)
+	if len(t.freed) == freedHistory {
+		t.freed = t.freed[1:]
+	}
+	t.freed = append(t.freed, e)
+}
+
+// Lookup 資源の種類と持ち主を返す（最近解放した資源も含む）
+func (t *Tracker) Lookup(id uint32) (kind Kind, owner string, ok bool) {
+	if t == nil {
+		return "", "", false
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if e, ok := t.live[id]; ok {
+		return e.kind, e.owner, true
+	}
+	for i := len(t.freed) - 1; i >= 0; i-- {
+		if e := t.freed[i]; e.id == id {
+			return e.kind, e.owner, true
+		}
+	}
+	return "", "", false
+}
+
+// Counts 解放していない資源の数を種類ごとに返す
+func (t *Tracker) Counts() map[Kind]int {
+	counts := make(map[Kind]int)
+	if t == nil {
+		return counts
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for _, e := range t.live {
+		counts[e.kind]++
+	}
+	return counts
+}
+
+// Live 解放していない資源のIDを小さい順に返す
+func (t *Tracker) Live(kind Kind) []uint32 {
+	if t == nil {
+		return nil
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	var ids []uint32
+	for id, e := range t.live {
+		if e.kind == kind {
+			ids = append(ids, id)
+		}
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	return ids
+}
+
+// Reset 記録をすべて消す（接続が切れて資源がサーバー側で消えた時に使う）
+func (t *Tracker) Reset() {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.live = make(map[uint32]entry)
+	t.freed = nil
+}
@@ -0,0 +1,80 @@
+package resource
+
+import (
+	"maps"
+	"slices"
+	"testing"
+)
+
+func TestTracker(t *testing.T) {
+	tr := NewTracker()
+	tr.Add(Window, 3)
+	tr.Add(Window, 1)
+	tr.Add(Pixmap, 2)
+	tr.Add(GC, 4)
+	tr.Remove(4)
+	tr.Remove(99) // 記録していない資源は無視する
+
+	want := map[Kind]int{Window: 2, Pixmap: 1}
+	if got := tr.Counts(); !maps.Equal(got, want) {
+		t.Errorf("Counts() = %v, want %v", got, want)
+	}
+	if got := tr.Live(Window); !slices.Equal(got, []uint32{1, 3}) {
+		t.Errorf("Live(Window) = %v, want [1 3]", got)
+	}
+
+	tr.Reset()
+	if got := tr.Counts(); len(got) != 0 {
+		t.Errorf("Reset後の Counts() = %v, want 空", got)
+	}
+}
+
+func TestLookup(t *testing.T) {
+	tr := NewTracker()
+	tr.Add(Window, 1)
+	tr.SetOwner(1, "trail")
+	tr.Add(Pixmap, 2)
+
+	if kind, owner, ok := tr.Lookup(1); !ok || kind != Window || owner != "trail" {
+		t.Errorf("Lookup(1) = %q, %q, %v, want window, trail", kind, owner, ok)
+	}
+
+	// 解放した後に届くエラーのために、最近解放した資源も引ける
+	tr.Remove(1)
+	if kind, owner, ok := tr.Lookup(1); !ok || kind != Window || owner != "trail" {
+		t.Errorf("解放後の Lookup(1) = %q, %q, %v, want window, trail", kind, owner, ok)
+	}
+
+	for id := uint32(100); id < 100+freedHistory; id++ {
+		tr.Add(GC, id)
+		tr.Remove(id)
+	}
+	if _, _, ok := tr.Lookup(1); ok {
+		t.Error("古い解放済みの資源を覚えている")
+	}
+	if kind, _, ok := tr.Lookup(2); !ok || kind != Pixmap {
+		t.Errorf("Lookup(2) = %q, %v, want pixmap", kind, ok)
+	}
+	if _, _, ok := tr.Lookup(99); ok {
+		t.Error("記録していない資源が見つかった")
+	}
+}
+
+func TestNilTracker(t *testing.T) {
+	var tr *Tracker
+	tr.Add(Window, 1)
+	tr.SetOwner(1, "trail")
+	tr.Remove(1)
+	tr.Reset()
+
+	if _, _, ok := tr.Lookup(1); ok {
+		t.Error("Lookup() が見つけた")
+	}
+
+	if got := tr.Counts(); len(got) != 0 {
+		t.Errorf("Counts() = %v, want 空", got)
+	}
+	if got := tr.Live(Window); got != nil {
+		t.Errorf("Live() = %v, want nil", got)
+	}
+}
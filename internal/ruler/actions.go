@@ -0,0 +1,252 @@
+package ruler
+
+import (
+	"fmt"
+	"log"
+)
+
+// アクション名
+const (
+	ActionToggle      = "toggle"       // 表示・非表示の切り替え
+	ActionNextMode    = "next-mode"    // 次のモードへ切り替え
+	ActionGrow        = "grow"         // 高さを増やす
+	ActionShrink      = "shrink"       // 高さを減らす
+	ActionOpacityUp   = "opacity-up"   // 不透明度を上げる
+	ActionOpacityDown = "opacity-down" // 不透明度を下げる
+	ActionPin         = "pin"          // カーソルへの追従を止める・再開する
+	ActionClearTrail  = "clear-trail"  // 軌跡を消す
+	ActionQuit        = "quit"         // 終了する
+)
+
+const (
+	resizeStep  = 10 // grow/shrinkで変える高さ（ピクセル）
+	opacityStep = 10 // opacity-up/downで変える不透明度（パーセント）
+)
+
+// Actions 利用できるアクション名の一覧を返す
+func Actions() []string {
+	return []string{
+		ActionToggle,
+		ActionNextMode,
+		ActionGrow,
+		ActionShrink,
+		ActionOpacityUp,
+		ActionOpacityDown,
+		ActionPin,
+		ActionClearTrail,
+		ActionQuit,
+	}
+}
+
+// actionTable アクション名と処理の対応表
+func (r *Ruler) actionTable() map[string]func() {
+	return map[string]func(){
+		ActionToggle:      r.ToggleVisibility,
+		ActionNextMode:    r.NextMode,
+		ActionGrow:        func() { r.Resize(resizeStep) },
+		ActionShrink:      func() { r.Resize(-resizeStep) },
+		ActionOpacityUp:   func() { r.AdjustOpacity(opacityStep) },
+		ActionOpacityDown: func() { r.AdjustOpacity(-opacityStep) },
+		ActionPin:         r.TogglePin,
+		ActionClearTrail:  r.ClearTrail,
+		ActionQuit:        r.Quit,
+	}
+}
+
+// Do 名前付きアクションを実行
+func (r *Ruler) Do(action string) error {
+	fn, ok := r.actionTable()[action]
+	if !ok {
+		return fmt.Errorf("不明なアクションです: %q", action)
+	}
+	fn()
+	return nil
+}
+
+// ToggleVisibility 表示状態を切り替え（表示時は再作成）
+func (r *Ruler) ToggleVisibility() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.setVisible(!r.visible)
+}
+
+// SetVisible 表示状態を指定する（既にその状態なら何もしない）
+func (r *Ruler) SetVisible(visible bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if visible != r.visible {
+		r.setVisible(visible)
+	}
+}
+
+// setVisible 表示状態を変える（表示時は再作成）
+// 呼び出し側で r.mu をロックしておくこと
+func (r *Ruler) setVisible(visible bool) {
+	r.visible = visible
+
+	if r.visible {
+		// 軌跡マネージャをクリーンアップ
+		if r.trailMgr != nil {
+			r.trailMgr.Clear()
+		}
+
+		if err := r.rebuildWindows(); err != nil {
+			log.Printf("ウィンドウ再作成エラー: %v", err)
+			return
+		}
+
+		log.Println("ルーラー表示: ON")
+	} else {
+		for _, win := range r.windows {
+			r.backend.UnmapWindow(win)
+		}
+		r.backend.Flush()
+		log.Println("ルーラー表示: OFF")
+	}
+}
+
+// NextMode 次のモードへ切り替える（最後のモードの次は先頭に戻る）
+func (r *Ruler) NextMode() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if len(r.modes) < 2 {
+		return
+	}
+
+	r.switchMode((r.modeIdx + 1) % len(r.modes))
+}
+
+// switchMode modes内の位置を指定してモードを切り替える
+// 呼び出し側で r.mu をロックしておくこと
+func (r *Ruler) switchMode(idx int) {
+	r.modeIdx = idx
+	r.mode = r.modes[idx]
+
+	// 前のモードの軌跡は残さない
+	if r.trailMgr != nil {
+		r.trailMgr.Clear()
+	}
+
+	log.Printf("モード切り替え: %s", r.mode.Name())
+
+	if !r.visible {
+		// 非表示中は再表示時に新しいモードで作り直される
+		return
+	}
+
+	if err := r.rebuildWindows(); err != nil {
+		log.Printf("ウィンドウ再作成エラー: %v", err)
+	}
+}
+
+// Resize 現在のモードの高さをdeltaピクセル変える
+func (r *Ruler) Resize(delta int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.setMode(r.mode.Resize(delta))
+
+	if !r.visible {
+		return
+	}
+
+	// 背景のグラデーションは高さに合わせて描画するため、作り直す
+	if err := r.rebuildWindows(); err != nil {
+		log.Printf("ウィンドウ再作成エラー: %v", err)
+	}
+}
+
+// AdjustOpacity 現在のモードの不透明度をdeltaパーセント変える
+func (r *Ruler) AdjustOpacity(delta float64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.setOpacity(r.mode.GetOpacity() + delta)
+}
+
+// SetOpacity 現在のモードの不透明度をパーセントで指定する
+func (r *Ruler) SetOpacity(percent float64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.setOpacity(percent)
+}
+
+// setOpacity 現在のモードの不透明度を変える（0から100に収める）
+// 呼び出し側で r.mu をロックしておくこと
+func (r *Ruler) setOpacity(percent float64) {
+	opacity := min(100, max(0, percent))
+	r.setMode(r.mode.WithOpacity(opacity))
+
+	if err := r.setupTransparency(); err != nil {
+		log.Printf("透明度設定エラー: %v", err)
+	}
+	log.Printf("不透明度: %.0f%%", opacity)
+}
+
+// TogglePin ウィンドウをその場に固定する・追従を再開する
+func (r *Ruler) TogglePin() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.setPinned(!r.pinned)
+}
+
+// SetPinned 固定するかを指定する（既にその状態なら何もしない）
+func (r *Ruler) SetPinned(pinned bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if pinned != r.pinned {
+		r.setPinned(pinned)
+	}
+}
+
+// setPinned ウィンドウを固定する・追従を再開する
+// 呼び出し側で r.mu をロックしておくこと
+func (r *Ruler) setPinned(pinned bool) {
+	r.pinned = pinned
+	if r.pinned {
+		log.Println("ルーラー固定: ON")
+		return
+	}
+
+	log.Println("ルーラー固定: OFF")
+	if r.visible && len(r.windows) > 0 {
+		cx, cy, err := r.getCursor()
+		if err != nil {
+			log.Println(err)
+			return
+		}
+		// 固定中にカーソルが別のモニターへ移っていた場合は作り直す
+		r.followMonitor(cx, cy)
+		r.mode.UpdateWindows(r.backend, r.windows, cx, cy, r.monitor)
+	}
+}
+
+// ClearTrail 表示中の軌跡をすべて消す
+func (r *Ruler) ClearTrail() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.trailMgr != nil {
+		r.trailMgr.Clear()
+	}
+}
+
+// Quit Runを終了させる
+func (r *Ruler) Quit() {
+	r.quitOnce.Do(func() {
+		close(r.quit)
+	})
+}
+
+// setMode 現在のモードを差し替える（巡回するモード一覧にも反映する）
+// 呼び出し側で r.mu をロックしておくこと
+func (r *Ruler) setMode(mode Mode) {
+	r.mode = mode
+	r.modes[r.modeIdx] = mode
+}
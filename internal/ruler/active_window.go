@@ -0,0 +1,80 @@
+package ruler
+
+import (
+	"github.com/BurntSushi/xgb/xproto"
+	"github.com/BurntSushi/xgbutil"
+	"github.com/BurntSushi/xgbutil/ewmh"
+	"github.com/BurntSushi/xgbutil/icccm"
+	"github.com/BurntSushi/xgbutil/xevent"
+	"github.com/BurntSushi/xgbutil/xprop"
+	"github.com/BurntSushi/xgbutil/xwindow"
+)
+
+const atomActiveWindow = "_NET_ACTIVE_WINDOW" // アクティブウィンドウを表すアトム名
+
+// WindowInfo アクティブウィンドウの情報
+type WindowInfo struct {
+	Instance string // WM_CLASSのインスタンス名
+	Class    string // WM_CLASSのクラス名
+	Title    string // ウィンドウタイトル（_NET_WM_NAME、なければWM_NAME）
+}
+
+// WatchActiveWindow アクティブウィンドウの変更を監視し、変わるたびにfnを呼ぶ
+// 監視開始時にも現在のアクティブウィンドウでfnを呼ぶ
+func (r *Ruler) WatchActiveWindow(fn func(WindowInfo)) error {
+	r.mu.Lock()
+	r.onActiveWindow = fn
+	r.mu.Unlock()
+
+	activeAtom, err := xprop.Atm(r.xuConn, atomActiveWindow)
+	if err != nil {
+		return err
+	}
+
+	root := xwindow.New(r.xuConn, r.xuConn.RootWin())
+	if err := root.Listen(xproto.EventMaskPropertyChange); err != nil {
+		return err
+	}
+
+	var last xproto.Window
+	notify := func() {
+		win, err := ewmh.ActiveWindowGet(r.xuConn)
+		if err != nil || win == last {
+			return
+		}
+		last = win
+		fn(activeWindowInfo(r.xuConn, win))
+	}
+
+	xevent.PropertyNotifyFun(func(X *xgbutil.XUtil, e xevent.PropertyNotifyEvent) {
+		if e.Atom == activeAtom {
+			notify()
+		}
+	}).Connect(r.xuConn, r.xuConn.RootWin())
+
+	notify()
+
+	return nil
+}
+
+// activeWindowInfo ウィンドウのクラス名とタイトルを取得
+// 取得できない項目は空文字列のままにする
+func activeWindowInfo(xuConn *xgbutil.XUtil, win xproto.Window) WindowInfo {
+	var info WindowInfo
+	if win == 0 {
+		return info
+	}
+
+	if class, err := icccm.WmClassGet(xuConn, win); err == nil {
+		info.Instance = class.Instance
+		info.Class = class.Class
+	}
+
+	if title, err := ewmh.WmNameGet(xuConn, win); err == nil && title != "" {
+		info.Title = title
+	} else if title, err := icccm.WmNameGet(xuConn, win); err == nil {
+		info.Title = title
+	}
+
+	return info
+}
@@ -0,0 +1,160 @@
+package ruler
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/kijimaD/xruler/internal/resource"
+)
+
+// Status ルーラーの状態
+type Status struct {
+	Visible bool     `json:"visible"` // 表示中か
+	Pinned  bool     `json:"pinned"`  // カーソルへの追従を止めているか
+	Mode    string   `json:"mode"`    // 現在のモード名
+	Modes   []string `json:"modes"`   // 切り替え対象のモード名
+	Opacity float64  `json:"opacity"` // 現在のモードの不透明度（パーセント）
+	Monitor Monitor  `json:"monitor"` // カーソルがあるモニター
+	Trails  int      `json:"trails"`  // 表示中の軌跡の数
+}
+
+// Status 現在の状態を返す
+func (r *Ruler) Status() Status {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	modes := make([]string, len(r.modes))
+	for i, m := range r.modes {
+		modes[i] = m.Name()
+	}
+
+	trails := 0
+	if r.trailMgr != nil {
+		trails = r.trailMgr.Len()
+	}
+
+	return Status{
+		Visible: r.visible,
+		Pinned:  r.pinned,
+		Mode:    r.mode.Name(),
+		Modes:   modes,
+		Opacity: r.mode.GetOpacity(),
+		Monitor: r.monitor,
+		Trails:  trails,
+	}
+}
+
+// Resources 作成して解放していないX資源の数を種類ごとに返す（解放漏れの調査に使う）
+func (r *Ruler) Resources() map[resource.Kind]int {
+	return r.resources.Counts()
+}
+
+// Errors 応答を待たないリクエストで起きたXエラーの数をサブシステムとエラー名ごとに返す
+func (r *Ruler) Errors() map[string]map[string]int {
+	return r.xerrors.Counts()
+}
+
+// Exec コマンドを実行し、結果を返す
+// 外部から実行中のルーラーを操作するための入口で、以下のコマンドを受け付ける
+//
+//	status              状態を返す
+//	resources           解放していないX資源の数を返す
+//	errors              起きたXエラーの数を返す
+//	mode NAME           モードを切り替える
+//	set KEY VALUE       設定を変える（opacity, visible, pinned）
+//	ACTION              名前付きアクションを実行する（toggle, next-mode など）
+func (r *Ruler) Exec(args []string) (any, error) {
+	if len(args) == 0 {
+		return nil, fmt.Errorf("コマンドを指定してください")
+	}
+
+	switch cmd, params := args[0], args[1:]; cmd {
+	case "status":
+		return r.Status(), nil
+	case "resources":
+		return r.Resources(), nil
+	case "errors":
+		return r.Errors(), nil
+	case "mode":
+		if len(params) != 1 {
+			return nil, fmt.Errorf("使い方: mode NAME")
+		}
+		if err := r.SetMode(params[0]); err != nil {
+			return nil, err
+		}
+	case "set":
+		if len(params) != 2 {
+			return nil, fmt.Errorf("使い方: set KEY VALUE")
+		}
+		if err := r.set(params[0], params[1]); err != nil {
+			return nil, err
+		}
+	default:
+		if len(params) != 0 {
+			return nil, fmt.Errorf("%s は引数を取りません", cmd)
+		}
+		if err := r.Do(cmd); err != nil {
+			return nil, err
+		}
+	}
+
+	return r.Status(), nil
+}
+
+// SetMode 名前を指定してモードを切り替える
+func (r *Ruler) SetMode(name string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for i, m := range r.modes {
+		if m.Name() != name {
+			continue
+		}
+		if i != r.modeIdx {
+			r.switchMode(i)
+		}
+		return nil
+	}
+
+	return fmt.Errorf("モード %q は切り替え対象にありません", name)
+}
+
+// set 名前を指定して設定を変える
+func (r *Ruler) set(key, value string) error {
+	switch key {
+	case "opacity":
+		opacity, err := strconv.ParseFloat(value, 64)
+		if err != nil || opacity < 0 || opacity > 100 {
+			return fmt.Errorf("opacity は0から100の数値で指定してください: %q", value)
+		}
+		r.SetOpacity(opacity)
+	case "visible":
+		visible, err := parseSwitch(value)
+		if err != nil {
+			return err
+		}
+		r.SetVisible(visible)
+	case "pinned":
+		pinned, err := parseSwitch(value)
+		if err != nil {
+			return err
+		}
+		r.SetPinned(pinned)
+	default:
+		return fmt.Errorf("不明な設定項目です: %q（opacity, visible, pinned）", key)
+	}
+
+	return nil
+}
+
+// parseSwitch on/off などの文字列を真偽値に変換
+func parseSwitch(s string) (bool, error) {
+	switch s {
+	case "on", "true", "1", "yes":
+		return true, nil
+	case "off", "false", "0", "no":
+		return false, nil
+	default:
+		return false, fmt.Errorf("on または off で指定してください: %q", s)
+	}
+}
@@ -0,0 +1,109 @@
+package ruler
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/BurntSushi/xgb/xfixes"
+	"github.com/BurntSushi/xgb/xproto"
+	"github.com/BurntSushi/xgbutil"
+	"github.com/BurntSushi/xgbutil/xprop"
+	"github.com/kijimaD/xruler/internal/argb"
+	"github.com/kijimaD/xruler/internal/backend"
+)
+
+const atomCompositorPrefix = "_NET_WM_CM_S" // コンポジットマネージャが所有するセレクション名の接頭辞（後ろに画面番号が付く）
+
+// compositorSelection 画面のコンポジットマネージャを表すセレクションのアトムを返す
+func compositorSelection(xuConn *xgbutil.XUtil) (xproto.Atom, error) {
+	return xprop.Atm(xuConn, fmt.Sprintf("%s%d", atomCompositorPrefix, xuConn.Conn().DefaultScreen))
+}
+
+// compositing コンポジットマネージャが動いているかを返す
+// EWMHに従い、画面ごとのセレクションの所有者がいるかで判定する
+func compositing(xuConn *xgbutil.XUtil) bool {
+	selection, err := compositorSelection(xuConn)
+	if err != nil {
+		return false
+	}
+
+	owner, err := xproto.GetSelectionOwner(xuConn.Conn(), selection).Reply()
+	if err != nil {
+		return false
+	}
+	return owner.Owner != xproto.WindowNone
+}
+
+// openScreen コンポジットマネージャの有無に合わせて描画するビジュアルを選び、そのビジュアルで描くバックエンドを用意する
+// コンポジットマネージャがあれば32ビットARGBビジュアルを使い、なければ
+// アルファが無視されるため従来の24ビットのウィンドウにする
+// 呼び出し側で r.mu をロックしておくこと（Init では不要）
+func (r *Ruler) openScreen() error {
+	screen, err := argb.Open(r.xuConn.Conn(), compositing(r.xuConn), r.resources)
+	if err != nil {
+		return err
+	}
+	if r.screen != nil {
+		r.screen.Free()
+	}
+	r.screen = screen
+	r.backend = backend.NewX11(r.xConn, r.xuConn, screen, r.resources, r.conn.abandon)
+
+	switch {
+	case screen.ARGB():
+		log.Println("32ビットARGBビジュアルで描画します")
+	case !screen.Composited():
+		log.Println("コンポジットマネージャがないため、ルーラーは ruler.fallback の描き方で表示します")
+	}
+	return nil
+}
+
+// setupCompositorNotify コンポジットマネージャのセレクションの所有者の変化を購読
+func (r *Ruler) setupCompositorNotify() error {
+	if _, err := backend.InitXFixes(r.xConn); err != nil {
+		return err
+	}
+
+	selection, err := compositorSelection(r.xuConn)
+	if err != nil {
+		return err
+	}
+
+	root := xproto.Setup(r.xConn).DefaultScreen(r.xConn).Root
+	return xfixes.SelectSelectionInputChecked(r.xConn, root, selection,
+		xfixes.SelectionEventMaskSetSelectionOwner|
+			xfixes.SelectionEventMaskSelectionWindowDestroy|
+			xfixes.SelectionEventMaskSelectionClientClose).Check()
+}
+
+// refreshCompositor コンポジットマネージャの起動・終了に合わせてウィンドウと軌跡を作り直す
+func (r *Ruler) refreshCompositor() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.closed {
+		return
+	}
+
+	// 古いビジュアルのカラーマップを解放する前に、それを使うウィンドウと軌跡を破棄する
+	r.destroyWindows()
+	r.trailMgr.Clear()
+
+	if err := r.openScreen(); err != nil {
+		// 選び直せなかった場合は元のビジュアルのまま作り直す
+		log.Printf("ビジュアルの選択エラー: %v", err)
+	}
+
+	// 軌跡は新しいビジュアルで描き直す
+	r.trailMgr.SetBackend(r.backend)
+	r.trailMgr.SetFading(r.screen.Composited())
+
+	if !r.visible {
+		// 非表示中は再表示時に作り直される
+		return
+	}
+
+	if err := r.rebuildWindows(); err != nil {
+		log.Printf("ウィンドウ再作成エラー: %v", err)
+	}
+}
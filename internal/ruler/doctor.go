@@ -0,0 +1,249 @@
+package ruler
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sort"
+
+	"github.com/BurntSushi/xgb"
+	"github.com/BurntSushi/xgb/randr"
+	"github.com/BurntSushi/xgb/render"
+	"github.com/BurntSushi/xgb/shape"
+	"github.com/BurntSushi/xgb/xproto"
+	"github.com/BurntSushi/xgbutil"
+	"github.com/BurntSushi/xgbutil/keybind"
+	"github.com/kijimaD/xruler/internal/argb"
+	"github.com/kijimaD/xruler/internal/backend"
+	"github.com/kijimaD/xruler/internal/xconn"
+)
+
+const (
+	renderMajor = 0  // 確認するRENDER拡張のメジャーバージョン
+	renderMinor = 11 // 確認するRENDER拡張のマイナーバージョン
+)
+
+// CheckStatus 診断項目の結果
+type CheckStatus int
+
+const (
+	CheckOK   CheckStatus = iota // 問題なし
+	CheckWarn                    // 動くが一部の機能が使えない
+	CheckFail                    // 起動できないか、主な機能が使えない
+)
+
+// Check 診断項目ごとの結果
+type Check struct {
+	Name   string      // 項目名
+	Status CheckStatus // 結果
+	Detail string      // 見つかったもの（バージョンなど）やエラー
+	Hint   string      // 問題がある場合の対処法
+}
+
+// extensionCheck 拡張ごとの確認方法と、ない場合の影響
+type extensionCheck struct {
+	name    string
+	version func(conn *xgb.Conn) (string, error)
+	missing CheckStatus
+	hint    string
+}
+
+var extensionChecks = []extensionCheck{
+	{
+		name: "XFIXES",
+		version: func(conn *xgb.Conn) (string, error) {
+			reply, err := backend.InitXFixes(conn)
+			if err != nil {
+				return "", err
+			}
+			return fmt.Sprintf("%d.%d", reply.MajorVersion, reply.MinorVersion), nil
+		},
+		missing: CheckFail,
+		hint:    "ルーラーがマウスのクリックを遮ります。XFIXES拡張を有効にしたXサーバーを使ってください",
+	},
+	{
+		name: "SHAPE",
+		version: func(conn *xgb.Conn) (string, error) {
+			if err := shape.Init(conn); err != nil {
+				return "", err
+			}
+			reply, err := shape.QueryVersion(conn).Reply()
+			if err != nil {
+				return "", err
+			}
+			return fmt.Sprintf("%d.%d", reply.MajorVersion, reply.MinorVersion), nil
+		},
+		missing: CheckWarn,
+		hint:    "隠すモードと、コンポジットマネージャがない時の ruler.fallback（stipple, outline）が使えません",
+	},
+	{
+		name: "RENDER",
+		version: func(conn *xgb.Conn) (string, error) {
+			if err := render.Init(conn); err != nil {
+				return "", err
+			}
+			reply, err := render.QueryVersion(conn, renderMajor, renderMinor).Reply()
+			if err != nil {
+				return "", err
+			}
+			return fmt.Sprintf("%d.%d", reply.MajorVersion, reply.MinorVersion), nil
+		},
+		missing: CheckWarn,
+		hint:    "ぼかし（ruler.feather）とアンチエイリアスした軌跡が使えません",
+	},
+	{
+		name: "RandR",
+		version: func(conn *xgb.Conn) (string, error) {
+			if err := randr.Init(conn); err != nil {
+				return "", err
+			}
+			reply, err := randr.QueryVersion(conn, randrMajor, randrMinor).Reply()
+			if err != nil {
+				return "", err
+			}
+			return fmt.Sprintf("%d.%d", reply.MajorVersion, reply.MinorVersion), nil
+		},
+		missing: CheckWarn,
+		hint:    "モニターはXineramaで検出し、画面構成の変更に追従しません",
+	},
+	{
+		name: "XInput2",
+		version: func(conn *xgb.Conn) (string, error) {
+			_, major, minor, err := queryXInput2(conn)
+			if err != nil {
+				return "", err
+			}
+			return fmt.Sprintf("%d.%d", major, minor), nil
+		},
+		missing: CheckWarn,
+		hint:    "カーソル位置をポーリングで取得するため、カーソルが止まっていても定期的に起きます",
+	},
+}
+
+// Diagnose Xサーバーの環境を調べ、xrulerの機能が使えるかを項目ごとに返す
+// keymapはグラブできるかを確かめるキーの割り当て
+func Diagnose(keymap map[string]string) []Check {
+	display := os.Getenv("DISPLAY")
+	if display == "" {
+		return []Check{{
+			Name:   "DISPLAY",
+			Status: CheckFail,
+			Detail: "設定されていません",
+			Hint:   "Xのセッション内で実行するか、DISPLAY=:0 のように接続先を指定してください",
+		}}
+	}
+
+	conn, err := xconn.Dial(context.Background())
+	if err != nil {
+		return []Check{{
+			Name:   "DISPLAY",
+			Status: CheckFail,
+			Detail: fmt.Sprintf("%s に接続できません: %v", display, err),
+			Hint:   "Xサーバーが動いているか、XAUTHORITY が正しい認証ファイルを指しているか確認してください",
+		}}
+	}
+	defer conn.Close()
+
+	xuConn, err := xgbutil.NewConnXgb(conn.Conn)
+	if err != nil {
+		return []Check{{Name: "DISPLAY", Status: CheckFail, Detail: err.Error()}}
+	}
+
+	checks := []Check{{Name: "DISPLAY", Status: CheckOK, Detail: display}}
+	checks = append(checks, checkExtensions(conn.Conn)...)
+	checks = append(checks, checkCompositor(xuConn)...)
+	checks = append(checks, checkKeys(xuConn, keymap)...)
+	return checks
+}
+
+// checkExtensions 使う拡張の有無とバージョンを調べる
+func checkExtensions(conn *xgb.Conn) []Check {
+	checks := make([]Check, 0, len(extensionChecks))
+	for _, ext := range extensionChecks {
+		version, err := ext.version(conn)
+		if err != nil {
+			checks = append(checks, Check{Name: ext.name, Status: ext.missing, Detail: err.Error(), Hint: ext.hint})
+			continue
+		}
+		checks = append(checks, Check{Name: ext.name, Status: CheckOK, Detail: version})
+	}
+	return checks
+}
+
+// checkCompositor 透明度の表示に必要なコンポジットマネージャとARGBビジュアルを調べる
+func checkCompositor(xuConn *xgbutil.XUtil) []Check {
+	var checks []Check
+
+	if compositing(xuConn) {
+		checks = append(checks, Check{Name: "コンポジットマネージャ", Status: CheckOK, Detail: "動作中"})
+	} else {
+		checks = append(checks, Check{
+			Name:   "コンポジットマネージャ",
+			Status: CheckWarn,
+			Detail: "見つかりません",
+			Hint:   "不透明度とぼかしは反映されません。picom などを起動するか、ruler.fallback で表示を選んでください",
+		})
+	}
+
+	screen, err := argb.Open(xuConn.Conn(), true, nil)
+	switch {
+	case err != nil:
+		checks = append(checks, Check{Name: "ARGBビジュアル", Status: CheckWarn, Detail: err.Error()})
+	case screen.ARGB():
+		checks = append(checks, Check{Name: "ARGBビジュアル", Status: CheckOK, Detail: "32ビットTrueColor"})
+	default:
+		checks = append(checks, Check{
+			Name:   "ARGBビジュアル",
+			Status: CheckWarn,
+			Detail: "見つかりません",
+			Hint:   "ぼかしとアンチエイリアスした軌跡は使えず、24ビットのウィンドウで描画します",
+		})
+	}
+	if screen != nil {
+		screen.Free()
+	}
+
+	return checks
+}
+
+// checkKeys キーの割り当てをそれぞれグラブできるか調べる
+func checkKeys(xuConn *xgbutil.XUtil, keymap map[string]string) []Check {
+	// 起動中のxrulerが割り当てたキーは、グラブできなくても問題ではない
+	if _, owner, err := instanceOwner(xuConn); err == nil && owner != xproto.WindowNone {
+		return []Check{{
+			Name:   "キーの割り当て",
+			Status: CheckWarn,
+			Detail: fmt.Sprintf("起動中のxrulerがキーをグラブしているため確認できません（ウィンドウ 0x%x）", owner),
+			Hint:   "xruler quit で終了してから実行してください",
+		}}
+	}
+
+	keybind.Initialize(xuConn)
+
+	keys := make([]string, 0, len(keymap))
+	for key := range keymap {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var checks []Check
+	for _, key := range keys {
+		action := keymap[key]
+		if action == ActionNone {
+			continue
+		}
+
+		name := "キー " + key
+		if err := checkKeyGrab(xuConn, key); err != nil {
+			checks = append(checks, Check{
+				Name:   name,
+				Status: CheckFail,
+				Detail: fmt.Sprintf("%s を割り当てられません: %v", action, err),
+				Hint:   "他のアプリケーションが同じキーを使っています。設定の keys で別のキーを割り当ててください",
+			})
+			continue
+		}
+		checks = append(checks, Check{Name: name, Status: CheckOK, Detail: action})
+	}
+	return checks
+}
@@ -1,13 +1,6 @@
 package ruler
 
-import (
-	"log"
-
-	"github.com/BurntSushi/xgb"
-	"github.com/BurntSushi/xgb/xproto"
-	"github.com/BurntSushi/xgbutil"
-	"github.com/BurntSushi/xgbutil/xwindow"
-)
+import "github.com/kijimaD/xruler/internal/backend"
 
 // HideModeConfig 隠すモードの設定
 type HideModeConfig struct {
@@ -18,6 +11,7 @@ type HideModeConfig struct {
 	OverlayColor   uint32  // オーバーレイの色
 	BorderColor    uint32  // 枠線の色
 	OpacityPercent float64 // ウィンドウの不透明度（パーセント: 0-100）
+	Trail          bool    // カーソルの軌跡を表示するか
 }
 
 // DefaultHideModeConfig デフォルトの隠すモード設定
@@ -30,149 +24,124 @@ func DefaultHideModeConfig() HideModeConfig {
 		OverlayColor:   0xf0f0f0,
 		BorderColor:    0x000000,
 		OpacityPercent: 100,
+		Trail:          true,
 	}
 }
 
+// Name モード名を返す
+func (c HideModeConfig) Name() string {
+	return "hide"
+}
+
 // GetOpacity 不透明度を返す
 func (c HideModeConfig) GetOpacity() float64 {
 	return c.OpacityPercent
 }
 
-// CreateWindows ウィンドウを作成
-func (c HideModeConfig) CreateWindows(xuConn *xgbutil.XUtil, screenWidth, screenHeight int) ([]*xwindow.Window, error) {
-	windows := make([]*xwindow.Window, 4)
+// WithOpacity 不透明度を変えたモードを返す
+func (c HideModeConfig) WithOpacity(percent float64) Mode {
+	c.OpacityPercent = percent
+	return c
+}
 
-	// 上側のオーバーレイウィンドウ
-	topWin, err := xwindow.Generate(xuConn)
-	if err != nil {
-		return nil, err
-	}
-	if err := topWin.CreateChecked(
-		xuConn.RootWin(),
-		0, 0,
-		screenWidth, 1,
-		xproto.CwBackPixel|xproto.CwOverrideRedirect,
-		c.OverlayColor,
-		1,
-	); err != nil {
-		return nil, err
-	}
-	windows[0] = topWin
+// FollowsX 隠す領域はカーソルの左側から始まるため、X座標にも追従する
+func (c HideModeConfig) FollowsX() bool {
+	return true
+}
 
-	// 上側の枠線ウィンドウ
-	topBorderWin, err := xwindow.Generate(xuConn)
-	if err != nil {
-		return nil, err
-	}
-	if err := topBorderWin.CreateChecked(
-		xuConn.RootWin(),
-		0, 0,
-		screenWidth, c.BorderHeight,
-		xproto.CwBackPixel|xproto.CwOverrideRedirect,
-		c.BorderColor,
-		1,
-	); err != nil {
-		return nil, err
-	}
-	windows[1] = topBorderWin
+// ShowTrail カーソルの軌跡を表示するかを返す
+func (c HideModeConfig) ShowTrail() bool {
+	return c.Trail
+}
+
+// Height カーソル領域の高さを返す
+func (c HideModeConfig) Height() int {
+	return c.CursorHeight
+}
+
+// Resize カーソル領域（隠さずに見せる部分）の高さを変えたモードを返す
+func (c HideModeConfig) Resize(delta int) Mode {
+	c.CursorHeight = max(c.BorderHeight*2+1, c.CursorHeight+delta)
+	return c
+}
 
-	// 下側の枠線ウィンドウ
-	bottomBorderWin, err := xwindow.Generate(xuConn)
+// CreateWindows モニター全体を覆うウィンドウを作成
+// 隠す領域の形はSHAPEで切り抜き、枠線は同じ大きさの子ウィンドウを切り抜いて描く。
+// 子ウィンドウを先に破棄するよう、windowsの先頭に子ウィンドウを置く
+func (c HideModeConfig) CreateWindows(b backend.Backend, monitor Monitor) ([]backend.Window, error) {
+	// オーバーレイのウィンドウ
+	overlayWin, err := b.CreateWindow(backend.WindowSpec{
+		Rect:  backend.Rect{X: monitor.X, Y: monitor.Y, Width: monitor.Width, Height: monitor.Height},
+		Color: c.OverlayColor,
+		Owner: c.Name(),
+	})
 	if err != nil {
 		return nil, err
 	}
-	if err := bottomBorderWin.CreateChecked(
-		xuConn.RootWin(),
-		0, 0,
-		screenWidth, c.BorderHeight,
-		xproto.CwBackPixel|xproto.CwOverrideRedirect,
-		c.BorderColor,
-		1,
-	); err != nil {
-		return nil, err
-	}
-	windows[2] = bottomBorderWin
 
-	// 下側のオーバーレイウィンドウ
-	bottomWin, err := xwindow.Generate(xuConn)
+	// 枠線の子ウィンドウ（親の形の外側は表示されない）
+	borderWin, err := b.CreateWindow(backend.WindowSpec{
+		Parent: overlayWin,
+		Rect:   backend.Rect{Width: monitor.Width, Height: monitor.Height},
+		Color:  c.BorderColor,
+		Owner:  c.Name(),
+	})
 	if err != nil {
+		b.DestroyWindow(overlayWin)
 		return nil, err
 	}
-	if err := bottomWin.CreateChecked(
-		xuConn.RootWin(),
-		0, 0,
-		screenWidth, 1,
-		xproto.CwBackPixel|xproto.CwOverrideRedirect,
-		c.OverlayColor,
-		1,
-	); err != nil {
-		return nil, err
+
+	windows := []backend.Window{borderWin, overlayWin}
+
+	// カーソル位置が決まるまでは何も表示しない
+	for _, win := range windows {
+		if err := b.SetShape(win, nil); err != nil {
+			for _, win := range windows {
+				b.DestroyWindow(win)
+			}
+			return nil, err
+		}
 	}
-	windows[3] = bottomWin
 
 	for _, win := range windows {
-		win.Map()
+		b.MapWindow(win)
 	}
 
 	return windows, nil
 }
 
-// UpdateWindows カーソル位置に応じてウィンドウを更新
-func (c HideModeConfig) UpdateWindows(xConn *xgb.Conn, windows []*xwindow.Window, cursorX, cursorY, screenWidth, screenHeight int) {
-	topWin := windows[0]
-	topBorderWin := windows[1]
-	bottomBorderWin := windows[2]
-	bottomWin := windows[3]
-
+// Layout カーソル位置に応じた隠す領域と枠線を返す
+// カーソルの上下に隠す領域があり、カーソル側の端に枠線を引く。モニター外にははみ出さない
+func (c HideModeConfig) Layout(cursorX, cursorY int, monitor Monitor) []Rect {
 	cursorTop := cursorY - c.CursorHeight/2
 	cursorBottom := cursorY + c.CursorHeight/2
 
-	topStart := max(0, cursorTop-c.HideHeight)
-	topEnd := cursorTop
-	topHeight := topEnd - topStart
-
-	bottomStart := cursorBottom
-	bottomEnd := min(screenHeight, cursorBottom+c.HideHeight)
-	bottomHeight := bottomEnd - bottomStart
-
-	// カーソルの左側指定pxの範囲のみ表示
-	leftEdge := max(0, cursorX-c.HideWidth)
-	rightEdge := cursorX
-	width := rightEdge - leftEdge
-
-	if topHeight > 0 {
-		topID := xproto.Window(topWin.Id)
-		if err := xproto.ConfigureWindowChecked(xConn, topID,
-			xproto.ConfigWindowX|xproto.ConfigWindowY|xproto.ConfigWindowWidth|xproto.ConfigWindowHeight,
-			[]uint32{uint32(leftEdge), uint32(topStart), uint32(width), uint32(topHeight)}).Check(); err != nil {
-			log.Printf("topウィンドウ更新エラー: %v", err)
-		}
-	}
+	// カーソルの左側指定pxの範囲のみ隠す
+	left := cursorX - c.HideWidth
+	width := c.HideWidth
 
-	if topBorderWin != nil {
-		topBorderID := xproto.Window(topBorderWin.Id)
-		if err := xproto.ConfigureWindowChecked(xConn, topBorderID,
-			xproto.ConfigWindowX|xproto.ConfigWindowY|xproto.ConfigWindowWidth|xproto.ConfigWindowHeight,
-			[]uint32{uint32(leftEdge), uint32(cursorTop), uint32(width), uint32(c.BorderHeight)}).Check(); err != nil {
-			log.Printf("top枠線ウィンドウ更新エラー: %v", err)
-		}
+	band := func(top, bottom int, color uint32, role Role) Rect {
+		return Rect{X: left, Y: top, Width: width, Height: bottom - top, Color: color, Role: role}
 	}
 
-	if bottomBorderWin != nil {
-		bottomBorderID := xproto.Window(bottomBorderWin.Id)
-		if err := xproto.ConfigureWindowChecked(xConn, bottomBorderID,
-			xproto.ConfigWindowX|xproto.ConfigWindowY|xproto.ConfigWindowWidth|xproto.ConfigWindowHeight,
-			[]uint32{uint32(leftEdge), uint32(cursorBottom - c.BorderHeight), uint32(width), uint32(c.BorderHeight)}).Check(); err != nil {
-			log.Printf("bottom枠線ウィンドウ更新エラー: %v", err)
-		}
-	}
+	return clipRects(monitor,
+		band(cursorTop-c.HideHeight, cursorTop, c.OverlayColor, RoleOverlay),
+		band(cursorTop, cursorTop+c.BorderHeight, c.BorderColor, RoleBorder),
+		band(cursorBottom-c.BorderHeight, cursorBottom, c.BorderColor, RoleBorder),
+		band(cursorBottom, cursorBottom+c.HideHeight, c.OverlayColor, RoleOverlay),
+	)
+}
 
-	if bottomHeight > 0 {
-		bottomID := xproto.Window(bottomWin.Id)
-		if err := xproto.ConfigureWindowChecked(xConn, bottomID,
-			xproto.ConfigWindowX|xproto.ConfigWindowY|xproto.ConfigWindowWidth|xproto.ConfigWindowHeight,
-			[]uint32{uint32(leftEdge), uint32(bottomStart), uint32(width), uint32(bottomHeight)}).Check(); err != nil {
-			log.Printf("bottomウィンドウ更新エラー: %v", err)
-		}
-	}
+// UpdateWindows カーソル位置に応じてウィンドウの形を更新
+// 1フレームあたり形を変えるリクエストを2つ送るだけで、応答は待たない
+func (c HideModeConfig) UpdateWindows(b backend.Backend, windows []backend.Window, cursorX, cursorY int, monitor Monitor) {
+	borderWin := windows[0]
+	overlayWin := windows[1]
+
+	rects := c.Layout(cursorX, cursorY, monitor)
+
+	// 枠線の子ウィンドウは親の形の内側だけ表示されるため、親は枠線の部分も含める
+	overlay := append(shapeRects(rects, RoleOverlay, monitor), shapeRects(rects, RoleBorder, monitor)...)
+	b.SetShape(overlayWin, overlay)
+	b.SetShape(borderWin, shapeRects(rects, RoleBorder, monitor))
 }
@@ -0,0 +1,125 @@
+package ruler
+
+import (
+	"context"
+	"os"
+	"testing"
+
+	"github.com/BurntSushi/xgb"
+	"github.com/BurntSushi/xgb/xproto"
+	"github.com/BurntSushi/xgbutil"
+	"github.com/kijimaD/xruler/internal/argb"
+	"github.com/kijimaD/xruler/internal/backend"
+	"github.com/kijimaD/xruler/internal/xconn"
+)
+
+// fourWindowHideMode 4つのウィンドウを動かしていた以前の隠すモード（比較用）
+// 以前と同じく、ウィンドウの移動は1つずつ応答を待つ
+type fourWindowHideMode struct {
+	HideModeConfig
+	xConn *xgb.Conn
+}
+
+func (c fourWindowHideMode) CreateWindows(b backend.Backend, monitor Monitor) ([]backend.Window, error) {
+	colors := []uint32{c.OverlayColor, c.BorderColor, c.BorderColor, c.OverlayColor}
+	windows := make([]backend.Window, len(colors))
+	for i, color := range colors {
+		win, err := b.CreateWindow(backend.WindowSpec{
+			Rect:  backend.Rect{X: monitor.X, Y: monitor.Y, Width: monitor.Width, Height: 1},
+			Color: color,
+		})
+		if err != nil {
+			return nil, err
+		}
+		b.MapWindow(win)
+		windows[i] = win
+	}
+	return windows, nil
+}
+
+func (c fourWindowHideMode) UpdateWindows(b backend.Backend, windows []backend.Window, cursorX, cursorY int, monitor Monitor) {
+	cursorTop := cursorY - c.CursorHeight/2
+	cursorBottom := cursorY + c.CursorHeight/2
+
+	topStart := max(monitor.Y, cursorTop-c.HideHeight)
+	bottomEnd := min(monitor.Y+monitor.Height, cursorBottom+c.HideHeight)
+
+	leftEdge := max(monitor.X, cursorX-c.HideWidth)
+	width := cursorX - leftEdge
+
+	geometries := [][2]int{
+		{topStart, cursorTop - topStart},
+		{cursorTop, c.BorderHeight},
+		{cursorBottom - c.BorderHeight, c.BorderHeight},
+		{cursorBottom, bottomEnd - cursorBottom},
+	}
+	for i, g := range geometries {
+		if g[1] <= 0 {
+			continue
+		}
+		xproto.ConfigureWindowChecked(c.xConn, xproto.Window(windows[i]),
+			xproto.ConfigWindowX|xproto.ConfigWindowY|xproto.ConfigWindowWidth|xproto.ConfigWindowHeight,
+			[]uint32{uint32(leftEdge), uint32(g[0]), uint32(width), uint32(g[1])}).Check()
+	}
+}
+
+// BenchmarkHideModeUpdate 1フレームの更新で送るリクエスト数と時間を比べる
+func BenchmarkHideModeUpdate(b *testing.B) {
+	if os.Getenv("DISPLAY") == "" {
+		b.Skip("DISPLAY が設定されていません")
+	}
+	conn, err := xconn.Dial(context.Background())
+	if err != nil {
+		b.Skipf("Xサーバーに接続できません: %v", err)
+	}
+	defer conn.Close()
+
+	xuConn, err := xgbutil.NewConnXgb(conn.Conn)
+	if err != nil {
+		b.Fatal(err)
+	}
+	screen, err := argb.Open(conn.Conn, false, nil)
+	if err != nil {
+		b.Fatal(err)
+	}
+	x11 := backend.NewX11(conn.Conn, xuConn, screen, nil, nil)
+	monitor := queryMonitors(conn.Conn)[0]
+	config := DefaultHideModeConfig()
+
+	for _, bm := range []struct {
+		name string
+		mode Mode
+	}{
+		{"shaped", config},
+		{"four-windows", fourWindowHideMode{config, conn.Conn}},
+	} {
+		b.Run(bm.name, func(b *testing.B) {
+			windows, err := bm.mode.CreateWindows(x11, monitor)
+			if err != nil {
+				b.Fatal(err)
+			}
+			defer func() {
+				for _, win := range windows {
+					x11.DestroyWindow(win)
+				}
+			}()
+
+			update := func(i int) {
+				bm.mode.UpdateWindows(x11, windows, monitor.X+monitor.Width/2, monitor.Y+i%monitor.Height, monitor)
+			}
+
+			// リクエストのシーケンス番号の差から、1フレームで送るリクエスト数を数える
+			// （Checkは応答を待つためにリクエストを1つ追加で送るため、それも含まれる）
+			before := xproto.NoOperation(conn.Conn).Sequence
+			update(0)
+			after := xproto.NoOperation(conn.Conn).Sequence
+			b.ReportMetric(float64(after-before-1), "requests/op")
+
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				update(i)
+			}
+			conn.Sync()
+		})
+	}
+}
@@ -0,0 +1,186 @@
+package ruler
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/BurntSushi/xgb/xproto"
+	"github.com/BurntSushi/xgbutil"
+	"github.com/BurntSushi/xgbutil/xevent"
+	"github.com/BurntSushi/xgbutil/xprop"
+	"github.com/kijimaD/xruler/internal/resource"
+)
+
+const (
+	atomSelectionPrefix = "_XRULER_S"       // 起動中のxrulerが所有するセレクション名の接頭辞（後ろに画面番号が付く）
+	atomCommand         = "_XRULER_COMMAND" // 後から起動したxrulerがコマンドを書き込むプロパティ名
+	commandMaxLength    = 1 << 16           // 一度に読み込むコマンドの最大長（32bit単位）
+)
+
+// ErrAlreadyRunning 同じ画面で別のxrulerが動いていることを表すエラー
+var ErrAlreadyRunning = errors.New("xrulerは既に起動しています")
+
+// instanceOwner 画面ごとのセレクションと、その所有者（起動中のxrulerのウィンドウ）を返す
+func instanceOwner(xuConn *xgbutil.XUtil) (xproto.Atom, xproto.Window, error) {
+	selection, err := xprop.Atm(xuConn, fmt.Sprintf("%s%d", atomSelectionPrefix, xuConn.Conn().DefaultScreen))
+	if err != nil {
+		return 0, 0, err
+	}
+
+	owner, err := xproto.GetSelectionOwner(xuConn.Conn(), selection).Reply()
+	if err != nil {
+		return 0, 0, err
+	}
+	return selection, owner.Owner, nil
+}
+
+// claimInstance 画面ごとのセレクションを所有し、同じ画面で1つだけ動くようにする
+// 既に所有者がいる場合はその所有者ウィンドウを転送先として記録して ErrAlreadyRunning を返す
+func (r *Ruler) claimInstance() error {
+	selection, owner, err := instanceOwner(r.xuConn)
+	if err != nil {
+		return err
+	}
+	if owner != xproto.WindowNone {
+		r.forwardWin = owner
+		return ErrAlreadyRunning
+	}
+
+	// コマンドを受け取るための見えないウィンドウを作成
+	win, err := xproto.NewWindowId(r.xuConn.Conn())
+	if err != nil {
+		return err
+	}
+	if err := xproto.CreateWindowChecked(
+		r.xuConn.Conn(),
+		0,
+		win,
+		r.xuConn.RootWin(),
+		-1, -1, 1, 1, 0,
+		xproto.WindowClassInputOnly,
+		xproto.WindowNone,
+		xproto.CwOverrideRedirect|xproto.CwEventMask,
+		[]uint32{1, xproto.EventMaskPropertyChange},
+	).Check(); err != nil {
+		return err
+	}
+	r.instanceWin = win
+	r.resources.Add(resource.Window, uint32(win))
+	r.resources.SetOwner(uint32(win), "instance")
+
+	if err := xproto.SetSelectionOwnerChecked(r.xuConn.Conn(), win, selection, xproto.TimeCurrentTime).Check(); err != nil {
+		r.releaseInstance(win)
+		return err
+	}
+
+	// 同時に起動した別のxrulerに先を越されていないか確認
+	if _, owner, err = instanceOwner(r.xuConn); err != nil {
+		r.releaseInstance(win)
+		return err
+	}
+	if owner != win {
+		r.releaseInstance(win)
+		r.forwardWin = owner
+		return ErrAlreadyRunning
+	}
+
+	commandAtom, err := xprop.Atm(r.xuConn, atomCommand)
+	if err != nil {
+		r.releaseInstance(win)
+		return err
+	}
+
+	xevent.PropertyNotifyFun(func(X *xgbutil.XUtil, e xevent.PropertyNotifyEvent) {
+		if e.Atom != commandAtom || e.State != xproto.PropertyNewValue {
+			return
+		}
+		r.queueForwarded(r.readCommands(commandAtom))
+	}).Connect(r.xuConn, win)
+
+	xevent.SelectionClearFun(func(X *xgbutil.XUtil, e xevent.SelectionClearEvent) {
+		log.Println("別のクライアントがセレクションを取得しました。単一起動の保証が失われています")
+	}).Connect(r.xuConn, win)
+
+	return nil
+}
+
+// releaseInstance 単一起動の準備に失敗したウィンドウを破棄し、資源の記録から外す
+func (r *Ruler) releaseInstance(win xproto.Window) {
+	xproto.DestroyWindow(r.xuConn.Conn(), win)
+	r.resources.Remove(uint32(win))
+	r.instanceWin = xproto.WindowNone
+}
+
+// queueForwarded 転送されたコマンドを順番待ちに加え、実行するゴルーチンがなければ起動する
+// Execは応答を待つためイベントループの外で実行し、届いた順を保つため1つのゴルーチンで順に実行する
+func (r *Ruler) queueForwarded(lines []string) {
+	r.forwardMu.Lock()
+	defer r.forwardMu.Unlock()
+
+	r.forwarded = append(r.forwarded, lines...)
+	if !r.forwarding && len(r.forwarded) > 0 {
+		r.forwarding = true
+		go r.runForwarded()
+	}
+}
+
+// runForwarded 順番待ちのコマンドを1つずつ実行し、なくなったら戻る
+func (r *Ruler) runForwarded() {
+	for {
+		r.forwardMu.Lock()
+		if len(r.forwarded) == 0 {
+			r.forwarding = false
+			r.forwardMu.Unlock()
+			return
+		}
+		line := r.forwarded[0]
+		r.forwarded = r.forwarded[1:]
+		r.forwardMu.Unlock()
+
+		if _, err := r.Exec(strings.Fields(line)); err != nil {
+			log.Printf("転送されたコマンドの実行エラー: %v", err)
+		}
+	}
+}
+
+// readCommands 転送されたコマンドを読み込み、プロパティを削除する
+func (r *Ruler) readCommands(commandAtom xproto.Atom) []string {
+	reply, err := xproto.GetProperty(r.xuConn.Conn(), true, r.instanceWin, commandAtom,
+		xproto.GetPropertyTypeAny, 0, commandMaxLength).Reply()
+	if err != nil {
+		log.Printf("転送されたコマンドの読み込みエラー: %v", err)
+		return nil
+	}
+
+	var lines []string
+	for _, line := range strings.Split(string(reply.Value), "\n") {
+		if strings.TrimSpace(line) != "" {
+			lines = append(lines, line)
+		}
+	}
+	return lines
+}
+
+// Forward 起動中のxrulerにコマンドを転送する
+// Initが ErrAlreadyRunning を返した後に呼ぶ
+func (r *Ruler) Forward(args []string) error {
+	if r.forwardWin == xproto.WindowNone {
+		return errors.New("転送先のxrulerが見つかりません")
+	}
+
+	commandAtom, err := xprop.Atm(r.xuConn, atomCommand)
+	if err != nil {
+		return err
+	}
+	utf8Atom, err := xprop.Atm(r.xuConn, "UTF8_STRING")
+	if err != nil {
+		return err
+	}
+
+	// 複数のxrulerが同時に転送しても失われないよう追記する
+	data := []byte(strings.Join(args, " ") + "\n")
+	return xproto.ChangePropertyChecked(r.xuConn.Conn(), xproto.PropModeAppend, r.forwardWin,
+		commandAtom, utf8Atom, 8, uint32(len(data)), data).Check()
+}
@@ -0,0 +1,602 @@
+//go:build integration
+
+package ruler
+
+// Xvfbを起動し、実際のXサーバー上でウィンドウの位置と形を確かめる
+// 実行するには Xvfb が必要:
+//
+//	go test -tags integration ./internal/ruler/
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+	"os/exec"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/BurntSushi/xgb/res"
+	"github.com/BurntSushi/xgb/shape"
+	"github.com/BurntSushi/xgb/xproto"
+	"github.com/BurntSushi/xgb/xtest"
+	"github.com/kijimaD/xruler/internal/backend"
+	"github.com/kijimaD/xruler/internal/trail"
+	"github.com/kijimaD/xruler/internal/xconn"
+)
+
+const (
+	xvfbWidth   = 1280            // Xvfbの画面の幅
+	xvfbHeight  = 1024            // Xvfbの画面の高さ
+	waitTimeout = 3 * time.Second // ウィンドウが期待した状態になるまで待つ時間
+)
+
+// xvfbErr Xvfbを起動できなかった理由（起動できた場合はnil）
+var xvfbErr error
+
+func TestMain(m *testing.M) {
+	stop, err := startXvfb()
+	xvfbErr = err
+
+	code := m.Run()
+	if stop != nil {
+		stop()
+	}
+	os.Exit(code)
+}
+
+// startXvfb 空いているディスプレイ番号でXvfbを起動し、DISPLAYに設定する
+func startXvfb() (func(), error) {
+	path, err := exec.LookPath("Xvfb")
+	if err != nil {
+		return nil, err
+	}
+
+	// -displayfd で、接続できるようになったディスプレイ番号を受け取る
+	r, w, err := os.Pipe()
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	cmd := exec.Command(path, "-displayfd", "3",
+		"-screen", "0", fmt.Sprintf("%dx%dx24", xvfbWidth, xvfbHeight),
+		"-nolisten", "tcp",
+		// 最後のクライアントが切断してもアトムなどを消さない
+		"-noreset")
+	cmd.ExtraFiles = []*os.File{w}
+	if err := cmd.Start(); err != nil {
+		w.Close()
+		return nil, err
+	}
+	w.Close()
+
+	stop := func() {
+		cmd.Process.Kill()
+		cmd.Wait()
+	}
+
+	number, err := bufio.NewReader(r).ReadString('\n')
+	if err != nil {
+		stop()
+		return nil, fmt.Errorf("Xvfbのディスプレイ番号を読めません: %w", err)
+	}
+	os.Setenv("DISPLAY", ":"+strings.TrimSpace(number))
+	os.Unsetenv("XAUTHORITY")
+
+	return stop, nil
+}
+
+// testServer テストからXサーバーを調べる接続
+type testServer struct {
+	conn *xconn.Conn
+	root xproto.Window
+}
+
+// newTestServer Xvfbに接続する（Xvfbがなければテストを飛ばす）
+func newTestServer(t *testing.T) *testServer {
+	t.Helper()
+
+	if xvfbErr != nil {
+		t.Skipf("Xvfbを起動できません: %v", xvfbErr)
+	}
+	conn, err := xconn.Dial(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(conn.Close)
+
+	if err := xtest.Init(conn.Conn); err != nil {
+		t.Fatal(err)
+	}
+	if err := shape.Init(conn.Conn); err != nil {
+		t.Fatal(err)
+	}
+
+	return &testServer{conn: conn, root: xproto.Setup(conn.Conn).DefaultScreen(conn.Conn).Root}
+}
+
+// warp XTESTでカーソルを動かす
+func (s *testServer) warp(t *testing.T, x, y int) {
+	t.Helper()
+
+	if err := xtest.FakeInputChecked(s.conn.Conn, xproto.MotionNotify, 0, 0, s.root, int16(x), int16(y), 0).Check(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// geometry ウィンドウの位置と大きさを返す
+func (s *testServer) geometry(win backend.Window) (backend.Rect, error) {
+	geom, err := xproto.GetGeometry(s.conn.Conn, xproto.Drawable(win)).Reply()
+	if err != nil {
+		return backend.Rect{}, err
+	}
+	return backend.Rect{X: int(geom.X), Y: int(geom.Y), Width: int(geom.Width), Height: int(geom.Height)}, nil
+}
+
+// region ウィンドウの形（kindはshape.SkBoundingかshape.SkInput）を返す
+func (s *testServer) region(win xproto.Window, kind shape.Kind) ([]backend.Rect, error) {
+	reply, err := shape.GetRectangles(s.conn.Conn, win, kind).Reply()
+	if err != nil {
+		return nil, err
+	}
+	rects := make([]backend.Rect, len(reply.Rectangles))
+	for i, r := range reply.Rectangles {
+		rects[i] = backend.Rect{X: int(r.X), Y: int(r.Y), Width: int(r.Width), Height: int(r.Height)}
+	}
+	return rects, nil
+}
+
+// children ウィンドウの子ウィンドウを返す
+func (s *testServer) children(win xproto.Window) ([]xproto.Window, error) {
+	tree, err := xproto.QueryTree(s.conn.Conn, win).Reply()
+	if err != nil {
+		return nil, err
+	}
+	return tree.Children, nil
+}
+
+// viewable 表示されているルートウィンドウの子ウィンドウを返す
+func (s *testServer) viewable(t *testing.T) []xproto.Window {
+	t.Helper()
+
+	children, err := s.children(s.root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var windows []xproto.Window
+	for _, win := range children {
+		attrs, err := xproto.GetWindowAttributes(s.conn.Conn, win).Reply()
+		if err != nil {
+			continue
+		}
+		if attrs.MapState == xproto.MapStateViewable {
+			windows = append(windows, win)
+		}
+	}
+	return windows
+}
+
+// sameRegion 2つの矩形の集まりが同じ領域を覆うかを返す
+// Xサーバーは形を帯状に分割し直して返すため、矩形の並びではなく覆う領域で比べる
+func sameRegion(a, b []backend.Rect) bool {
+	var xs, ys []int
+	for _, r := range append(slices.Clone(a), b...) {
+		xs = append(xs, r.X, r.X+r.Width)
+		ys = append(ys, r.Y, r.Y+r.Height)
+	}
+	slices.Sort(xs)
+	slices.Sort(ys)
+
+	covers := func(rects []backend.Rect, x, y int) bool {
+		for _, r := range rects {
+			if x >= r.X && x < r.X+r.Width && y >= r.Y && y < r.Y+r.Height {
+				return true
+			}
+		}
+		return false
+	}
+
+	// 辺の座標で区切った各区画の左上が、両方で覆われているか確かめる
+	for _, x := range xs {
+		for _, y := range ys {
+			if covers(a, x, y) != covers(b, x, y) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// runRuler ルーラーを起動し、テストの終わりに止める
+func runRuler(t *testing.T, trailConfig trail.Config, modes ...Mode) *Ruler {
+	t.Helper()
+
+	r := New(modes, trailConfig)
+	if err := r.Init(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- r.Run(ctx)
+	}()
+
+	t.Cleanup(func() {
+		cancel()
+		if err := <-done; err != nil {
+			t.Error(err)
+		}
+		r.Close()
+	})
+	return r
+}
+
+// noTrail 軌跡を表示しない設定
+func noTrail() trail.Config {
+	config := trail.DefaultConfig()
+	config.Enabled = false
+	return config
+}
+
+// currentWindows ルーラーのウィンドウを返す
+func currentWindows(r *Ruler) []backend.Window {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return slices.Clone(r.windows)
+}
+
+// eventually checkがnilを返すまで待つ
+func eventually(t *testing.T, check func() error) {
+	t.Helper()
+
+	deadline := time.Now().Add(waitTimeout)
+	for {
+		err := check()
+		if err == nil {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatal(err)
+		}
+		time.Sleep(PollInterval)
+	}
+}
+
+func TestIntegrationRulerMode(t *testing.T) {
+	s := newTestServer(t)
+	config := DefaultRulerModeConfig()
+	r := runRuler(t, noTrail(), config)
+	// Xvfbには XInput2 があるため、以下の追従はポーリングではなく移動イベントで行う
+	if r.motion == nil {
+		t.Fatal("XInput2でカーソルの移動を購読していない")
+	}
+
+	windows := currentWindows(r)
+	if len(windows) != 1 {
+		t.Fatalf("ウィンドウ = %v, want 1つ", windows)
+	}
+	if children, err := s.children(s.root); err != nil || !slices.Contains(children, xproto.Window(windows[0])) {
+		t.Fatalf("ルートウィンドウの子にルーラーがない: %v, %v", children, err)
+	}
+
+	for _, tt := range []struct {
+		x, y int
+		want backend.Rect
+	}{
+		{x: 100, y: 500, want: backend.Rect{X: 0, Y: 470, Width: xvfbWidth, Height: config.RulerHeight}},
+		{x: 800, y: 5, want: backend.Rect{X: 0, Y: 0, Width: xvfbWidth, Height: config.RulerHeight}},
+		{x: 800, y: xvfbHeight - 1, want: backend.Rect{X: 0, Y: xvfbHeight - config.RulerHeight, Width: xvfbWidth, Height: config.RulerHeight}},
+	} {
+		s.warp(t, tt.x, tt.y)
+		eventually(t, func() error {
+			got, err := s.geometry(windows[0])
+			if err != nil {
+				return err
+			}
+			if got != tt.want {
+				return fmt.Errorf("(%d, %d): geometry = %+v, want %+v", tt.x, tt.y, got, tt.want)
+			}
+			return nil
+		})
+	}
+}
+
+// TestIntegrationNoCompositor コンポジットマネージャがなくても起動し、ルーラーを間引いて表示する
+func TestIntegrationNoCompositor(t *testing.T) {
+	s := newTestServer(t)
+	config := DefaultRulerModeConfig()
+	config.Fallback = backend.FallbackStipple
+	r := runRuler(t, noTrail(), config)
+
+	windows := currentWindows(r)
+	if len(windows) != 1 {
+		t.Fatalf("ウィンドウ = %v, want 1つ", windows)
+	}
+	rects, err := s.region(xproto.Window(windows[0]), shape.SkBounding)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rects) < 2 {
+		t.Errorf("市松模様に切り抜かれていない: %+v", rects)
+	}
+}
+
+func TestIntegrationHideMode(t *testing.T) {
+	s := newTestServer(t)
+	config := DefaultHideModeConfig()
+	r := runRuler(t, noTrail(), config)
+
+	windows := currentWindows(r)
+	if len(windows) != 2 {
+		t.Fatalf("ウィンドウ = %v, want 2つ", windows)
+	}
+	border, overlay := windows[0], windows[1]
+
+	// 枠線はオーバーレイの子ウィンドウ
+	if children, err := s.children(xproto.Window(overlay)); err != nil || !slices.Contains(children, xproto.Window(border)) {
+		t.Fatalf("オーバーレイの子に枠線がない: %v, %v", children, err)
+	}
+	r.mu.Lock()
+	monitor := r.monitor
+	r.mu.Unlock()
+
+	// 2つ目は横方向だけの移動（Y座標が同じでも追従する）
+	for _, p := range [][2]int{{1000, 540}, {700, 540}, {700, 200}} {
+		s.warp(t, p[0], p[1])
+
+		rects := config.Layout(p[0], p[1], monitor)
+		wantBorder := shapeRects(rects, RoleBorder, monitor)
+		wantOverlay := append(shapeRects(rects, RoleOverlay, monitor), wantBorder...)
+
+		eventually(t, func() error {
+			for _, w := range []struct {
+				name string
+				win  backend.Window
+				want []backend.Rect
+			}{
+				{"枠線", border, wantBorder},
+				{"オーバーレイ", overlay, wantOverlay},
+			} {
+				got, err := s.region(xproto.Window(w.win), shape.SkBounding)
+				if err != nil {
+					return err
+				}
+				if !sameRegion(got, w.want) {
+					return fmt.Errorf("(%d, %d): %sの形 = %+v, want %+v", p[0], p[1], w.name, got, w.want)
+				}
+			}
+			return nil
+		})
+	}
+}
+
+// TestIntegrationClickThrough ルーラーと軌跡のウィンドウは、入力の形が空でクリックを通す
+func TestIntegrationClickThrough(t *testing.T) {
+	for _, mode := range []Mode{DefaultRulerModeConfig(), DefaultHideModeConfig()} {
+		t.Run(mode.Name(), func(t *testing.T) {
+			s := newTestServer(t)
+			trailConfig := trail.DefaultConfig()
+			trailConfig.Duration = time.Minute
+			r := runRuler(t, trailConfig, mode)
+
+			// 軌跡を残す
+			for i := 0; i < 5; i++ {
+				s.warp(t, 300+i*40, 300+i*20)
+				time.Sleep(2 * PollInterval)
+			}
+			eventually(t, func() error {
+				r.mu.Lock()
+				defer r.mu.Unlock()
+				if !r.trailMgr.Active() {
+					return fmt.Errorf("軌跡が表示されていない")
+				}
+				return nil
+			})
+
+			windows := s.viewable(t)
+			for _, win := range currentWindows(r) {
+				if !slices.Contains(windows, xproto.Window(win)) {
+					windows = append(windows, xproto.Window(win))
+				}
+			}
+			for _, win := range windows {
+				input, err := s.region(win, shape.SkInput)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if len(input) != 0 {
+					t.Errorf("ウィンドウ %d の入力の形 = %+v, want 空", win, input)
+				}
+			}
+		})
+	}
+}
+
+// clientResources テスト以外のクライアントが持つX資源の数を、種類の名前ごとに合計する（X-Resource拡張を使う）
+func (s *testServer) clientResources(t *testing.T) map[string]uint32 {
+	t.Helper()
+
+	clients, err := res.QueryClients(s.conn.Conn).Reply()
+	if err != nil {
+		t.Fatal(err)
+	}
+	self := xproto.Setup(s.conn.Conn).ResourceIdBase
+
+	counts := make(map[string]uint32)
+	for _, client := range clients.Clients {
+		// Xサーバー自身（ルートウィンドウなど）とテストの接続は数えない
+		if client.ResourceBase == 0 || client.ResourceBase == self {
+			continue
+		}
+		reply, err := res.QueryClientResources(s.conn.Conn, client.ResourceBase).Reply()
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, typ := range reply.Types {
+			name, err := xproto.GetAtomName(s.conn.Conn, typ.ResourceType).Reply()
+			if err != nil {
+				t.Fatal(err)
+			}
+			counts[name.Name] += typ.Count
+		}
+	}
+	return counts
+}
+
+// TestIntegrationResources 軌跡が消えた後や表示を切り替えた後に、X資源が元の数に戻る
+func TestIntegrationResources(t *testing.T) {
+	s := newTestServer(t)
+	if err := res.Init(s.conn.Conn); err != nil {
+		t.Skipf("X-Resource拡張がありません: %v", err)
+	}
+
+	trailConfig := trail.DefaultConfig()
+	trailConfig.Duration = 200 * time.Millisecond
+	r := runRuler(t, trailConfig, DefaultRulerModeConfig(), DefaultHideModeConfig())
+
+	// カーソルを動かした時の軌跡が消えてから数える
+	trailsGone := func(t *testing.T) {
+		t.Helper()
+		eventually(t, func() error {
+			r.mu.Lock()
+			defer r.mu.Unlock()
+			if r.trailMgr.Active() {
+				return fmt.Errorf("軌跡が残っている（%d本）", r.trailMgr.Len())
+			}
+			return nil
+		})
+	}
+	s.warp(t, 100, 100)
+	time.Sleep(2 * PollInterval)
+	trailsGone(t)
+	baseline := s.clientResources(t)
+	tracked := r.Resources()
+
+	// 記録と実際の資源の数が変わらなくなるまで待つ
+	assertBaseline := func(t *testing.T) {
+		t.Helper()
+		eventually(t, func() error {
+			if got := r.Resources(); !maps.Equal(got, tracked) {
+				return fmt.Errorf("記録した資源 = %v, want %v", got, tracked)
+			}
+			if got := s.clientResources(t); !maps.Equal(got, baseline) {
+				return fmt.Errorf("Xサーバーの資源 = %v, want %v", got, baseline)
+			}
+			return nil
+		})
+	}
+
+	t.Run("軌跡が消えた後", func(t *testing.T) {
+		for i := 0; i < 10; i++ {
+			s.warp(t, 100+i*30, 100+i*15)
+			time.Sleep(2 * PollInterval)
+		}
+		trailsGone(t)
+		assertBaseline(t)
+	})
+
+	t.Run("表示を切り替えた後", func(t *testing.T) {
+		for i := 0; i < 3; i++ {
+			r.ToggleVisibility()
+			r.ToggleVisibility()
+		}
+		assertBaseline(t)
+	})
+
+	t.Run("モードを切り替えた後", func(t *testing.T) {
+		r.NextMode()
+		r.NextMode()
+		assertBaseline(t)
+	})
+}
+
+// TestIntegrationSecondInstance 後から起動したxrulerは、片付けても起動中のxrulerのウィンドウを破棄しない
+func TestIntegrationSecondInstance(t *testing.T) {
+	newTestServer(t)
+	first := runRuler(t, noTrail(), DefaultRulerModeConfig())
+
+	second := New([]Mode{DefaultRulerModeConfig()}, noTrail())
+	defer second.Close()
+	if err := second.Init(context.Background()); !errors.Is(err, ErrAlreadyRunning) {
+		t.Fatalf("Init() = %v, want ErrAlreadyRunning", err)
+	}
+	if second.instanceWin != xproto.WindowNone || second.forwardWin != first.instanceWin {
+		t.Fatalf("instanceWin = %d, forwardWin = %d, want 0, %d", second.instanceWin, second.forwardWin, first.instanceWin)
+	}
+	second.cleanup()
+
+	_, owner, err := instanceOwner(first.xuConn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if owner != first.instanceWin {
+		t.Errorf("セレクションの所有者 = %d, want %d", owner, first.instanceWin)
+	}
+}
+
+// xrandrSize xrandrで画面の大きさを変える（変えられない環境ではテストを飛ばす）
+func xrandrSize(t *testing.T, width, height int) {
+	t.Helper()
+
+	path, err := exec.LookPath("xrandr")
+	if err != nil {
+		t.Skipf("xrandrがありません: %v", err)
+	}
+	if out, err := exec.Command(path, "-s", fmt.Sprintf("%dx%d", width, height)).CombinedOutput(); err != nil {
+		t.Skipf("xrandrで画面の大きさを変えられません: %v: %s", err, out)
+	}
+}
+
+// TestIntegrationScreenChange 画面の大きさが変わると、RandRの通知でモニター一覧とウィンドウを作り直す
+func TestIntegrationScreenChange(t *testing.T) {
+	s := newTestServer(t)
+	config := DefaultRulerModeConfig()
+	r := runRuler(t, noTrail(), config)
+
+	const width, height = 1024, 768
+	xrandrSize(t, width, height)
+	t.Cleanup(func() {
+		// 後のテストは元の画面の大きさを前提にする
+		if out, err := exec.Command("xrandr", "-s", fmt.Sprintf("%dx%d", xvfbWidth, xvfbHeight)).CombinedOutput(); err != nil {
+			t.Errorf("画面の大きさを戻せません: %v: %s", err, out)
+		}
+	})
+
+	want := []Monitor{{Width: width, Height: height}}
+	if got := queryMonitors(s.conn.Conn); !slices.Equal(got, want) {
+		t.Fatalf("xrandr後のモニター = %+v, want %+v", got, want)
+	}
+
+	eventually(t, func() error {
+		r.mu.Lock()
+		monitors := slices.Clone(r.monitors)
+		r.mu.Unlock()
+		if !slices.Equal(monitors, want) {
+			return fmt.Errorf("ルーラーのモニター = %+v, want %+v", monitors, want)
+		}
+		return nil
+	})
+
+	// 作り直したルーラーは新しい画面の幅で、画面内に収まる
+	s.warp(t, 100, height-1)
+	eventually(t, func() error {
+		windows := currentWindows(r)
+		if len(windows) != 1 {
+			return fmt.Errorf("ウィンドウ = %v, want 1つ", windows)
+		}
+		got, err := s.geometry(windows[0])
+		if err != nil {
+			return err
+		}
+		if want := (backend.Rect{X: 0, Y: height - config.RulerHeight, Width: width, Height: config.RulerHeight}); got != want {
+			return fmt.Errorf("geometry = %+v, want %+v", got, want)
+		}
+		return nil
+	})
+}
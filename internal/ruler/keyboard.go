@@ -0,0 +1,82 @@
+package ruler
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+
+	"github.com/BurntSushi/xgbutil"
+	"github.com/BurntSushi/xgbutil/keybind"
+)
+
+// ActionNone キーの割り当てを解除するためのアクション名
+const ActionNone = "none"
+
+// DefaultKeymap デフォルトのキー割り当て
+func DefaultKeymap() map[string]string {
+	return map[string]string{
+		"Control-Shift-space": ActionToggle,
+		"Control-Shift-m":     ActionNextMode,
+	}
+}
+
+// BindKeys キーマップに従ってルートウィンドウでグローバルにキーをキャプチャする
+// 以前の割り当ては解除される。グラブに失敗したキーはエラーとして報告し、残りのキーは割り当てる
+func (r *Ruler) BindKeys(keymap map[string]string) error {
+	r.mu.Lock()
+	r.keymap = keymap
+	b := r.backend
+	r.mu.Unlock()
+
+	b.UngrabKeys()
+
+	keys := make([]string, 0, len(keymap))
+	for key := range keymap {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var errs []error
+	for _, key := range keys {
+		action := keymap[key]
+		if action == ActionNone {
+			continue
+		}
+
+		fn, ok := r.actionTable()[action]
+		if !ok {
+			errs = append(errs, fmt.Errorf("%s: 不明なアクションです: %q", key, action))
+			continue
+		}
+
+		// X のイベントループを止めないよう別のゴルーチンで実行する
+		if err := b.GrabKey(key, func() { go fn() }); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", key, err))
+			continue
+		}
+
+		log.Printf("キーバインド設定: %s → %s", key, action)
+	}
+
+	return errors.Join(errs...)
+}
+
+// checkKeyGrab キーをグラブできるかを確かめ、すぐに解除する
+// 別のクライアントが同じキーをグラブしている場合はエラーを返す
+// keybind.Initialize を呼んでおくこと
+func checkKeyGrab(xuConn *xgbutil.XUtil, key string) error {
+	mods, keycodes, err := keybind.ParseString(xuConn, key)
+	if err != nil {
+		return err
+	}
+
+	root := xuConn.RootWin()
+	for _, keycode := range keycodes {
+		if err := keybind.GrabChecked(xuConn, root, mods, keycode); err != nil {
+			return err
+		}
+		keybind.Ungrab(xuConn, root, mods, keycode)
+	}
+	return nil
+}
@@ -0,0 +1,62 @@
+package ruler
+
+import "github.com/kijimaD/xruler/internal/backend"
+
+// Role 配置する矩形の役割
+type Role int
+
+const (
+	RoleRuler   Role = iota // ルーラーの帯
+	RoleOverlay             // 隠すモードで隠す領域
+	RoleBorder              // 隠すモードの枠線
+)
+
+// Rect モードが配置する矩形（ルートウィンドウ座標）
+type Rect struct {
+	X, Y          int
+	Width, Height int
+	Color         uint32 // 塗る色（0xRRGGBB）
+	Role          Role   // 矩形の役割
+}
+
+// Empty 面積がないかを返す
+func (r Rect) Empty() bool {
+	return r.Width <= 0 || r.Height <= 0
+}
+
+// clip 矩形のうちモニター内の部分を返す
+func (m Monitor) clip(r Rect) Rect {
+	left, top := max(r.X, m.X), max(r.Y, m.Y)
+	right, bottom := min(r.X+r.Width, m.X+m.Width), min(r.Y+r.Height, m.Y+m.Height)
+	r.X, r.Y = left, top
+	r.Width, r.Height = max(0, right-left), max(0, bottom-top)
+	return r
+}
+
+// clipRects 矩形をモニター内に切り詰め、面積がなくなったものを除く
+func clipRects(monitor Monitor, rects ...Rect) []Rect {
+	clipped := make([]Rect, 0, len(rects))
+	for _, r := range rects {
+		if r = monitor.clip(r); !r.Empty() {
+			clipped = append(clipped, r)
+		}
+	}
+	return clipped
+}
+
+// shapeRects 指定した役割の矩形を、モニターの左上からの座標にする
+func shapeRects(rects []Rect, role Role, monitor Monitor) []backend.Rect {
+	var out []backend.Rect
+	for _, r := range rects {
+		if r.Role != role {
+			continue
+		}
+		out = append(out, backend.Rect{
+			X:      r.X - monitor.X,
+			Y:      r.Y - monitor.Y,
+			Width:  r.Width,
+			Height: r.Height,
+		})
+	}
+	return out
+}
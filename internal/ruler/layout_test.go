@@ -0,0 +1,200 @@
+package ruler
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/kijimaD/xruler/internal/backend"
+)
+
+const (
+	testRulerColor   = 0x808080
+	testOverlayColor = 0xf0f0f0
+	testBorderColor  = 0x000000
+)
+
+var (
+	testMonitor      = Monitor{X: 0, Y: 0, Width: 1920, Height: 1080}
+	testRightMonitor = Monitor{X: 1920, Y: 0, Width: 1280, Height: 1024}
+	testRulerConfig  = RulerModeConfig{RulerHeight: 60, RulerColor: testRulerColor}
+	testHideConfig   = HideModeConfig{
+		HideHeight:   400,
+		HideWidth:    1000,
+		CursorHeight: 80,
+		BorderHeight: 2,
+		OverlayColor: testOverlayColor,
+		BorderColor:  testBorderColor,
+	}
+)
+
+func TestRulerModeLayout(t *testing.T) {
+	tests := []struct {
+		name    string
+		x       int
+		y       int
+		monitor Monitor
+		want    []Rect
+	}{
+		{
+			name:    "カーソルを中心にする",
+			x:       100,
+			y:       500,
+			monitor: testMonitor,
+			want:    []Rect{{X: 0, Y: 470, Width: 1920, Height: 60, Color: testRulerColor, Role: RoleRuler}},
+		},
+		{
+			name:    "上端ではモニター内に収める",
+			x:       100,
+			y:       5,
+			monitor: testMonitor,
+			want:    []Rect{{X: 0, Y: 0, Width: 1920, Height: 60, Color: testRulerColor, Role: RoleRuler}},
+		},
+		{
+			name:    "下端ではモニター内に収める",
+			x:       100,
+			y:       1079,
+			monitor: testMonitor,
+			want:    []Rect{{X: 0, Y: 1020, Width: 1920, Height: 60, Color: testRulerColor, Role: RoleRuler}},
+		},
+		{
+			name:    "右側のモニター",
+			x:       2000,
+			y:       300,
+			monitor: testRightMonitor,
+			want:    []Rect{{X: 1920, Y: 270, Width: 1280, Height: 60, Color: testRulerColor, Role: RoleRuler}},
+		},
+		{
+			name:    "モニターより高いルーラー",
+			x:       10,
+			y:       10,
+			monitor: Monitor{Width: 100, Height: 40},
+			want:    []Rect{{X: 0, Y: 0, Width: 100, Height: 40, Color: testRulerColor, Role: RoleRuler}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := testRulerConfig.Layout(tt.x, tt.y, tt.monitor)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Layout(%d, %d) = %+v, want %+v", tt.x, tt.y, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHideModeLayout(t *testing.T) {
+	tests := []struct {
+		name    string
+		x       int
+		y       int
+		monitor Monitor
+		want    []Rect
+	}{
+		{
+			name:    "カーソルの上下を隠す",
+			x:       1500,
+			y:       540,
+			monitor: testMonitor,
+			want: []Rect{
+				{X: 500, Y: 100, Width: 1000, Height: 400, Color: testOverlayColor, Role: RoleOverlay},
+				{X: 500, Y: 500, Width: 1000, Height: 2, Color: testBorderColor, Role: RoleBorder},
+				{X: 500, Y: 578, Width: 1000, Height: 2, Color: testBorderColor, Role: RoleBorder},
+				{X: 500, Y: 580, Width: 1000, Height: 400, Color: testOverlayColor, Role: RoleOverlay},
+			},
+		},
+		{
+			name:    "上端では上側を切り詰める",
+			x:       1500,
+			y:       20,
+			monitor: testMonitor,
+			want: []Rect{
+				{X: 500, Y: 58, Width: 1000, Height: 2, Color: testBorderColor, Role: RoleBorder},
+				{X: 500, Y: 60, Width: 1000, Height: 400, Color: testOverlayColor, Role: RoleOverlay},
+			},
+		},
+		{
+			name:    "下端では下側を切り詰める",
+			x:       1500,
+			y:       1000,
+			monitor: testMonitor,
+			want: []Rect{
+				{X: 500, Y: 560, Width: 1000, Height: 400, Color: testOverlayColor, Role: RoleOverlay},
+				{X: 500, Y: 960, Width: 1000, Height: 2, Color: testBorderColor, Role: RoleBorder},
+				{X: 500, Y: 1038, Width: 1000, Height: 2, Color: testBorderColor, Role: RoleBorder},
+				{X: 500, Y: 1040, Width: 1000, Height: 40, Color: testOverlayColor, Role: RoleOverlay},
+			},
+		},
+		{
+			name:    "左端では幅を切り詰める",
+			x:       300,
+			y:       540,
+			monitor: testMonitor,
+			want: []Rect{
+				{X: 0, Y: 100, Width: 300, Height: 400, Color: testOverlayColor, Role: RoleOverlay},
+				{X: 0, Y: 500, Width: 300, Height: 2, Color: testBorderColor, Role: RoleBorder},
+				{X: 0, Y: 578, Width: 300, Height: 2, Color: testBorderColor, Role: RoleBorder},
+				{X: 0, Y: 580, Width: 300, Height: 400, Color: testOverlayColor, Role: RoleOverlay},
+			},
+		},
+		{
+			name:    "右側のモニターの左端では左のモニターにはみ出さない",
+			x:       2000,
+			y:       500,
+			monitor: testRightMonitor,
+			want: []Rect{
+				{X: 1920, Y: 60, Width: 80, Height: 400, Color: testOverlayColor, Role: RoleOverlay},
+				{X: 1920, Y: 460, Width: 80, Height: 2, Color: testBorderColor, Role: RoleBorder},
+				{X: 1920, Y: 538, Width: 80, Height: 2, Color: testBorderColor, Role: RoleBorder},
+				{X: 1920, Y: 540, Width: 80, Height: 400, Color: testOverlayColor, Role: RoleOverlay},
+			},
+		},
+		{
+			name:    "カーソルがモニターの左端にあれば何も隠さない",
+			x:       0,
+			y:       540,
+			monitor: testMonitor,
+			want:    []Rect{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := testHideConfig.Layout(tt.x, tt.y, tt.monitor)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Layout(%d, %d) = %+v, want %+v", tt.x, tt.y, got, tt.want)
+			}
+		})
+	}
+}
+
+// TestLayoutInsideMonitor どのカーソル位置でも矩形がモニター内に収まり、負の大きさにならない
+func TestLayoutInsideMonitor(t *testing.T) {
+	modes := []Mode{testRulerConfig, testHideConfig}
+	for _, monitor := range []Monitor{testMonitor, testRightMonitor} {
+		for _, mode := range modes {
+			for y := monitor.Y; y < monitor.Y+monitor.Height; y += 7 {
+				for x := monitor.X; x < monitor.X+monitor.Width; x += 97 {
+					for _, r := range mode.Layout(x, y, monitor) {
+						if r.Empty() || r.X < monitor.X || r.Y < monitor.Y ||
+							r.X+r.Width > monitor.X+monitor.Width || r.Y+r.Height > monitor.Y+monitor.Height {
+							t.Fatalf("%s: Layout(%d, %d) がモニター %+v の外の矩形 %+v を返した", mode.Name(), x, y, monitor, r)
+						}
+					}
+				}
+			}
+		}
+	}
+}
+
+func TestShapeRects(t *testing.T) {
+	rects := []Rect{
+		{X: 1930, Y: 10, Width: 100, Height: 20, Role: RoleOverlay},
+		{X: 1940, Y: 30, Width: 50, Height: 2, Role: RoleBorder},
+	}
+
+	got := shapeRects(rects, RoleBorder, testRightMonitor)
+	want := []backend.Rect{{X: 20, Y: 30, Width: 50, Height: 2}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("shapeRects() = %+v, want %+v", got, want)
+	}
+}
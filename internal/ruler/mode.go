@@ -1,10 +1,6 @@
 package ruler
 
-import (
-	"github.com/BurntSushi/xgb"
-	"github.com/BurntSushi/xgbutil"
-	"github.com/BurntSushi/xgbutil/xwindow"
-)
+import "github.com/kijimaD/xruler/internal/backend"
 
 // ModeType 動作モードの種類
 type ModeType int
@@ -16,10 +12,24 @@ const (
 
 // Mode モードインターフェース
 type Mode interface {
-	// CreateWindows ウィンドウを作成
-	CreateWindows(xuConn *xgbutil.XUtil, screenWidth, screenHeight int) ([]*xwindow.Window, error)
-	// UpdateWindows カーソル位置に応じてウィンドウを更新
-	UpdateWindows(xConn *xgb.Conn, windows []*xwindow.Window, cursorX, cursorY, screenWidth, screenHeight int)
+	// CreateWindows モニター上にウィンドウを作成して表示
+	CreateWindows(b backend.Backend, monitor Monitor) ([]backend.Window, error)
+	// Layout カーソル位置に応じて表示する矩形を返す（X接続を使わない）
+	Layout(cursorX, cursorY int, monitor Monitor) []Rect
+	// UpdateWindows Layoutの矩形に合わせてウィンドウを配置
+	UpdateWindows(b backend.Backend, windows []backend.Window, cursorX, cursorY int, monitor Monitor)
+	// FollowsX 表示がカーソルのX座標にも追従するかを返す（falseなら横方向の移動では更新しない）
+	FollowsX() bool
+	// Name モード名を返す
+	Name() string
 	// GetOpacity 不透明度を返す
 	GetOpacity() float64
+	// WithOpacity 不透明度を変えたモードを返す
+	WithOpacity(percent float64) Mode
+	// ShowTrail このモードでカーソルの軌跡を表示するかを返す（軌跡の設定で無効にした場合は、ここでtrueを返しても表示しない）
+	ShowTrail() bool
+	// Height Resizeで変える高さを返す
+	Height() int
+	// Resize 高さをdeltaピクセル変えたモードを返す
+	Resize(delta int) Mode
 }
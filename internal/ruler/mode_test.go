@@ -0,0 +1,101 @@
+package ruler
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/kijimaD/xruler/internal/backend"
+)
+
+func TestRulerModeWindows(t *testing.T) {
+	fake := backend.NewFake()
+	config := testRulerConfig
+	config.Feather = 5
+	config.Fallback = backend.FallbackOutline
+
+	windows, err := config.CreateWindows(fake, testRightMonitor)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(windows) != 1 {
+		t.Fatalf("ウィンドウ数 = %d, want 1", len(windows))
+	}
+
+	win, _ := fake.Window(windows[0])
+	wantSpec := backend.WindowSpec{
+		Rect:     backend.Rect{X: 1920, Y: 0, Width: 1280, Height: 60},
+		Color:    testRulerColor,
+		Feather:  5,
+		Fallback: backend.FallbackOutline,
+		Owner:    "ruler",
+	}
+	if !reflect.DeepEqual(win.Spec, wantSpec) {
+		t.Errorf("Spec = %+v, want %+v", win.Spec, wantSpec)
+	}
+	if !win.Mapped {
+		t.Error("ウィンドウが表示されていない")
+	}
+
+	config.UpdateWindows(fake, windows, 2000, 300, testRightMonitor)
+	win, _ = fake.Window(windows[0])
+	if want := (backend.Rect{X: 1920, Y: 270, Width: 1280, Height: 60}); win.Rect != want {
+		t.Errorf("Rect = %+v, want %+v", win.Rect, want)
+	}
+}
+
+func TestHideModeWindows(t *testing.T) {
+	fake := backend.NewFake()
+
+	windows, err := testHideConfig.CreateWindows(fake, testMonitor)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(windows) != 2 {
+		t.Fatalf("ウィンドウ数 = %d, want 2", len(windows))
+	}
+
+	border, _ := fake.Window(windows[0])
+	overlay, _ := fake.Window(windows[1])
+	if border.Spec.Parent != windows[1] {
+		t.Errorf("枠線の親 = %d, want %d", border.Spec.Parent, windows[1])
+	}
+	if border.Spec.Color != testBorderColor || overlay.Spec.Color != testOverlayColor {
+		t.Errorf("色 = %#x, %#x", border.Spec.Color, overlay.Spec.Color)
+	}
+	for _, win := range []backend.FakeWindow{border, overlay} {
+		if !win.Mapped || win.Shape == nil || len(win.Shape) != 0 {
+			t.Errorf("作成直後は何も表示しない形で表示する: %+v", win)
+		}
+	}
+
+	fake.ResetCalls()
+	testHideConfig.UpdateWindows(fake, windows, 1500, 540, testMonitor)
+
+	// 1フレームの更新は形を2回変えるだけにする
+	if calls := fake.Calls(); len(calls) != 2 {
+		t.Errorf("呼び出し = %q, want 2回", calls)
+	}
+
+	border, _ = fake.Window(windows[0])
+	overlay, _ = fake.Window(windows[1])
+	wantBorder := []backend.Rect{
+		{X: 500, Y: 500, Width: 1000, Height: 2},
+		{X: 500, Y: 578, Width: 1000, Height: 2},
+	}
+	wantOverlay := append([]backend.Rect{
+		{X: 500, Y: 100, Width: 1000, Height: 400},
+		{X: 500, Y: 580, Width: 1000, Height: 400},
+	}, wantBorder...)
+	if !reflect.DeepEqual(border.Shape, wantBorder) {
+		t.Errorf("枠線の形 = %+v, want %+v", border.Shape, wantBorder)
+	}
+	if !reflect.DeepEqual(overlay.Shape, wantOverlay) {
+		t.Errorf("オーバーレイの形 = %+v, want %+v", overlay.Shape, wantOverlay)
+	}
+
+	// 親を破棄すると子ウィンドウも消える
+	fake.DestroyWindow(windows[1])
+	if live := fake.Live(); len(live) != 0 {
+		t.Errorf("破棄後に残ったウィンドウ = %v", live)
+	}
+}
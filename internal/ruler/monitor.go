@@ -0,0 +1,127 @@
+package ruler
+
+import (
+	"github.com/BurntSushi/xgb"
+	"github.com/BurntSushi/xgb/randr"
+	"github.com/BurntSushi/xgb/xinerama"
+	"github.com/BurntSushi/xgb/xproto"
+)
+
+const (
+	randrMajor = 1 // RandR拡張のメジャーバージョン
+	randrMinor = 3 // RandR拡張のマイナーバージョン（GetScreenResourcesCurrentに必要）
+)
+
+// Monitor モニターの矩形領域（ルートウィンドウ座標）
+type Monitor struct {
+	X      int // 左端のX座標
+	Y      int // 上端のY座標
+	Width  int // 幅
+	Height int // 高さ
+}
+
+// Contains 座標がモニター内に含まれるかを返す
+func (m Monitor) Contains(x, y int) bool {
+	return x >= m.X && x < m.X+m.Width && y >= m.Y && y < m.Y+m.Height
+}
+
+// queryMonitors モニター一覧を取得
+// RandRのCRTC情報を優先し、使えない場合はXinerama、最後に画面全体を1つのモニターとして扱う
+func queryMonitors(xConn *xgb.Conn) []Monitor {
+	if monitors, err := queryRandrMonitors(xConn); err == nil && len(monitors) > 0 {
+		return monitors
+	}
+	if monitors, err := queryXineramaMonitors(xConn); err == nil && len(monitors) > 0 {
+		return monitors
+	}
+
+	// 接続時のSetup情報は画面サイズ変更後に古くなるため、ルートウィンドウから取り直す
+	screen := xproto.Setup(xConn).DefaultScreen(xConn)
+	geom, err := xproto.GetGeometry(xConn, xproto.Drawable(screen.Root)).Reply()
+	if err != nil {
+		return []Monitor{{Width: int(screen.WidthInPixels), Height: int(screen.HeightInPixels)}}
+	}
+	return []Monitor{{Width: int(geom.Width), Height: int(geom.Height)}}
+}
+
+// queryRandrMonitors RandRから有効なCRTCの矩形を取得
+func queryRandrMonitors(xConn *xgb.Conn) ([]Monitor, error) {
+	if err := randr.Init(xConn); err != nil {
+		return nil, err
+	}
+	if _, err := randr.QueryVersion(xConn, randrMajor, randrMinor).Reply(); err != nil {
+		return nil, err
+	}
+
+	root := xproto.Setup(xConn).DefaultScreen(xConn).Root
+	resources, err := randr.GetScreenResourcesCurrent(xConn, root).Reply()
+	if err != nil {
+		return nil, err
+	}
+
+	monitors := make([]Monitor, 0, len(resources.Crtcs))
+	for _, crtc := range resources.Crtcs {
+		info, err := randr.GetCrtcInfo(xConn, crtc, resources.ConfigTimestamp).Reply()
+		if err != nil {
+			return nil, err
+		}
+		// 出力が繋がっていないCRTCは無効
+		if info.NumOutputs == 0 || info.Width == 0 || info.Height == 0 {
+			continue
+		}
+		monitors = append(monitors, Monitor{
+			X:      int(info.X),
+			Y:      int(info.Y),
+			Width:  int(info.Width),
+			Height: int(info.Height),
+		})
+	}
+
+	return monitors, nil
+}
+
+// queryXineramaMonitors Xineramaからスクリーンの矩形を取得
+func queryXineramaMonitors(xConn *xgb.Conn) ([]Monitor, error) {
+	if err := xinerama.Init(xConn); err != nil {
+		return nil, err
+	}
+
+	active, err := xinerama.IsActive(xConn).Reply()
+	if err != nil {
+		return nil, err
+	}
+	if active.State == 0 {
+		return nil, nil
+	}
+
+	reply, err := xinerama.QueryScreens(xConn).Reply()
+	if err != nil {
+		return nil, err
+	}
+
+	monitors := make([]Monitor, 0, len(reply.ScreenInfo))
+	for _, info := range reply.ScreenInfo {
+		monitors = append(monitors, Monitor{
+			X:      int(info.XOrg),
+			Y:      int(info.YOrg),
+			Width:  int(info.Width),
+			Height: int(info.Height),
+		})
+	}
+
+	return monitors, nil
+}
+
+// monitorAt 座標を含むモニターを返す
+// どのモニターにも含まれない場合は最初のモニターを返す
+func monitorAt(monitors []Monitor, x, y int) Monitor {
+	for _, m := range monitors {
+		if m.Contains(x, y) {
+			return m
+		}
+	}
+	if len(monitors) > 0 {
+		return monitors[0]
+	}
+	return Monitor{}
+}
@@ -0,0 +1,161 @@
+package ruler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/BurntSushi/xgb"
+	"github.com/BurntSushi/xgb/xproto"
+	"github.com/kijimaD/xruler/internal/backend"
+)
+
+const (
+	extensionXInput = "XInputExtension" // XInput拡張の名前
+	xiSelectEvents  = 46                // XISelectEventsリクエストのマイナーオペコード
+	xiQueryVersion  = 47                // XIQueryVersionリクエストのマイナーオペコード
+	xiMajor         = 2                 // 要求するXInput拡張のメジャーバージョン
+	xiMinor         = 2                 // 要求するXInput拡張のマイナーバージョン（2.1以降はグラブ中もRawMotionが届く）
+	xiAllMasterDevs = 1                 // すべてのマスターデバイスを表すデバイスID
+	xiRawMotion     = 17                // RawMotionイベントの種類
+	xiEventTypeEnd  = 10                // イベントの種類（8-9バイト目）までの長さ
+)
+
+// queryXInput2 XInput拡張のバージョン2以降に対応しているかを調べ、拡張のメジャーオペコードとバージョンを返す
+// xgbにはXInput2のバインディングがないため、XIQueryVersionを直接送る
+func queryXInput2(conn *xgb.Conn) (byte, uint16, uint16, error) {
+	extension, err := xproto.QueryExtension(conn, uint16(len(extensionXInput)), extensionXInput).Reply()
+	if err != nil {
+		return 0, 0, 0, err
+	}
+	if !extension.Present {
+		return 0, 0, 0, fmt.Errorf("%s: %w", extensionXInput, backend.ErrNoExtension)
+	}
+
+	buf := make([]byte, 8)
+	buf[0] = extension.MajorOpcode
+	buf[1] = xiQueryVersion
+	xgb.Put16(buf[2:], uint16(len(buf)/4))
+	xgb.Put16(buf[4:], xiMajor)
+	xgb.Put16(buf[6:], xiMinor)
+
+	cookie := conn.NewCookie(true, true)
+	conn.NewRequest(buf, cookie)
+	reply, err := cookie.Reply()
+	if err != nil {
+		return 0, 0, 0, err
+	}
+	if len(reply) < 12 {
+		return 0, 0, 0, errors.New("XIQueryVersionの応答が短すぎます")
+	}
+
+	major, minor := xgb.Get16(reply[8:]), xgb.Get16(reply[10:])
+	if major < xiMajor {
+		return 0, 0, 0, fmt.Errorf("バージョン %d.%d はXInput2に対応していません", major, minor)
+	}
+	return extension.MajorOpcode, major, minor, nil
+}
+
+// selectRawMotion ルートウィンドウでRawMotionイベント（すべてのマスターデバイスの移動）を購読する
+// RawMotionはカーソルがどのウィンドウの上にあっても、ルートウィンドウに届く
+func selectRawMotion(conn *xgb.Conn, opcode byte, root xproto.Window) error {
+	buf := make([]byte, 20)
+	buf[0] = opcode
+	buf[1] = xiSelectEvents
+	xgb.Put16(buf[2:], uint16(len(buf)/4))
+	xgb.Put32(buf[4:], uint32(root))
+	xgb.Put16(buf[8:], 1) // マスクの数
+	xgb.Put16(buf[12:], xiAllMasterDevs)
+	xgb.Put16(buf[14:], 1) // マスクの長さ（32bit単位）
+	xgb.Put32(buf[16:], 1<<xiRawMotion)
+
+	cookie := conn.NewCookie(true, false)
+	conn.NewRequest(buf, cookie)
+	return cookie.Check()
+}
+
+// isRawMotion evがopcodeの拡張（XInput）のRawMotionイベントかを返す
+func isRawMotion(ev []byte, opcode byte) bool {
+	return len(ev) >= xiEventTypeEnd &&
+		ev[0]&0x7f == xproto.GeGeneric &&
+		ev[1] == opcode &&
+		xgb.Get16(ev[8:]) == xiRawMotion
+}
+
+// setupMotion XInput2でカーソルの移動を購読し、移動するとmotionに通知が届くようにする
+// XInput2が使えない場合はmotionをnilにし、Runはポーリングでカーソルを追う
+// 呼び出し側で r.mu をロックしておくこと（Init では不要）
+func (r *Ruler) setupMotion() error {
+	r.motion = nil
+
+	opcode, _, _, err := queryXInput2(r.xConn)
+	if err != nil {
+		return err
+	}
+
+	// 通知は「前回確かめてから動いた」ことだけを表すため、溜めずに1つにまとめる
+	motion := make(chan struct{}, 1)
+	r.conn.x.HandleGenericEvents(func(ev []byte) {
+		if !isRawMotion(ev, opcode) {
+			return
+		}
+		select {
+		case motion <- struct{}{}:
+		default:
+		}
+	})
+
+	if err := selectRawMotion(r.xConn, opcode, xproto.Setup(r.xConn).DefaultScreen(r.xConn).Root); err != nil {
+		r.conn.x.HandleGenericEvents(nil)
+		return err
+	}
+	r.motion = motion
+	return nil
+}
+
+// waitNext 次にカーソル位置を確かめるまで待つ。終了する場合はfalseを返す
+// XInput2が使える場合はカーソルが動くまで眠り（軌跡が残っている間は消去のため PollInterval ごとに起きる）、
+// 高頻度で届く移動は前回の更新lastから PollInterval に1回へまとめる。
+// 使えない場合は pollInterval の間隔でポーリングする
+func (r *Ruler) waitNext(ctx context.Context, last time.Time, idleCount int, trailActive bool) bool {
+	if r.motion == nil {
+		return r.sleep(ctx, pollInterval(idleCount, trailActive))
+	}
+
+	var tick <-chan time.Time
+	if trailActive {
+		tick = time.After(PollInterval)
+	}
+
+	select {
+	case <-ctx.Done():
+		return false
+	case <-r.quit:
+		return false
+	case <-r.conn.x.Lost():
+		// 次のカーソル位置の取得で切断を検知して再接続する
+		return true
+	case <-r.conn.xu.Lost():
+		return true
+	case <-tick:
+		return true
+	case <-r.motion:
+	}
+	return r.sleep(ctx, PollInterval-time.Since(last))
+}
+
+// sleep dだけ待つ。終了する場合はfalseを返す
+func (r *Ruler) sleep(ctx context.Context, d time.Duration) bool {
+	if d <= 0 {
+		return true
+	}
+	select {
+	case <-ctx.Done():
+		return false
+	case <-r.quit:
+		return false
+	case <-time.After(d):
+		return true
+	}
+}
@@ -0,0 +1,37 @@
+package ruler
+
+import (
+	"testing"
+
+	"github.com/BurntSushi/xgb"
+	"github.com/BurntSushi/xgb/xproto"
+)
+
+// genericEvent 拡張opcodeの種類evtypeのGenericEventを作る
+func genericEvent(opcode byte, evtype uint16) []byte {
+	buf := make([]byte, 32)
+	buf[0] = xproto.GeGeneric
+	buf[1] = opcode
+	xgb.Put16(buf[8:], evtype)
+	return buf
+}
+
+func TestIsRawMotion(t *testing.T) {
+	const opcode = 131
+
+	for _, tt := range []struct {
+		name string
+		ev   []byte
+		want bool
+	}{
+		{"RawMotion", genericEvent(opcode, xiRawMotion), true},
+		{"別の種類", genericEvent(opcode, 6), false},
+		{"別の拡張", genericEvent(opcode+1, xiRawMotion), false},
+		{"GenericEventでない", make([]byte, 32), false},
+		{"短すぎる", genericEvent(opcode, xiRawMotion)[:8], false},
+	} {
+		if got := isRawMotion(tt.ev, opcode); got != tt.want {
+			t.Errorf("%s: isRawMotion() = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
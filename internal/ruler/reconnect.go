@@ -0,0 +1,170 @@
+package ruler
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/BurntSushi/xgb"
+	"github.com/BurntSushi/xgb/xproto"
+	"github.com/BurntSushi/xgbutil"
+	"github.com/BurntSushi/xgbutil/xevent"
+	"github.com/kijimaD/xruler/internal/xconn"
+)
+
+const (
+	replyTimeout      = 5 * time.Second  // 応答がない時に接続が切れたとみなすまでの時間
+	reconnectDelay    = time.Second      // 再接続を試みるまでの最初の待ち時間
+	maxReconnectDelay = 30 * time.Second // 再接続の待ち時間の上限
+)
+
+// connection Xサーバーへの接続（xgbで直接使う接続とxgbutilの接続の2本）
+type connection struct {
+	x      *xconn.Conn    // X11プロトコル接続
+	xu     *xconn.Conn    // xgbutilが使う接続
+	xuConn *xgbutil.XUtil // xgbutilユーティリティ接続
+}
+
+// dial Xサーバーへ接続する
+func dial(ctx context.Context) (*connection, error) {
+	xu, err := xconn.Dial(ctx)
+	if err != nil {
+		return nil, err
+	}
+	xuConn, err := xgbutil.NewConnXgb(xu.Conn)
+	if err != nil {
+		xu.Close()
+		return nil, err
+	}
+
+	x, err := xconn.Dial(ctx)
+	if err != nil {
+		xu.Close()
+		return nil, err
+	}
+	x.Sync()
+
+	return &connection{x: x, xu: xu, xuConn: xuConn}, nil
+}
+
+// lost どちらかの接続が切れているかを返す
+func (c *connection) lost() bool {
+	return c.x.IsLost() || c.xu.IsLost()
+}
+
+// abandon 接続を切断済みとして扱い、応答を待っている処理をすべてエラーで戻す
+func (c *connection) abandon() {
+	c.x.Abandon()
+	c.xu.Abandon()
+}
+
+// close 接続を閉じる
+func (c *connection) close() {
+	c.xu.Close()
+	c.x.Close()
+}
+
+// setConnection 使う接続を差し替える
+// 呼び出し側で r.mu をロックしておくこと（Init では不要）
+func (r *Ruler) setConnection(conn *connection) {
+	r.conn = conn
+	r.xConn = conn.x.Conn
+	r.xuConn = conn.xuConn
+}
+
+// startEventLoops xuConnとxConnのイベント処理を始める
+// どちらの接続に届いたXエラーも xerrors に渡す
+func (r *Ruler) startEventLoops() {
+	xevent.ErrorHandlerSet(r.xuConn, r.xerrors.Handle)
+	done := make(chan struct{})
+	r.mainDone = done
+	go func(xuConn *xgbutil.XUtil) {
+		xevent.Main(xuConn)
+		close(done)
+	}(r.xuConn)
+	go r.handleEvents(r.conn.x)
+}
+
+// stopEventLoops 切れた接続のイベント処理を止める
+func (r *Ruler) stopEventLoops() {
+	r.conn.abandon()
+
+	// 切断後の接続へのリクエストはエラーとしてイベントループに届くため、
+	// 記録せずに捨て、止まっているイベントループを起こして終了させる
+	xevent.ErrorHandlerSet(r.xuConn, func(xgb.Error) {})
+	xevent.Quit(r.xuConn)
+	xproto.NoOperation(r.xuConn.Conn())
+	<-r.mainDone
+}
+
+// reconnect 切れたX接続を張り直し、ウィンドウ・キーグラブ・軌跡を作り直す
+// 接続できるまで待ち時間を延ばしながら繰り返す。ctxのキャンセルか quit で諦めた場合は false を返す
+func (r *Ruler) reconnect(ctx context.Context) (bool, error) {
+	log.Println("Xサーバーとの接続が切れました。再接続します")
+	r.stopEventLoops()
+
+	delay := reconnectDelay
+	for {
+		select {
+		case <-ctx.Done():
+			return false, nil
+		case <-r.quit:
+			return false, nil
+		case <-time.After(delay):
+		}
+
+		err := r.redial(ctx)
+		if err == nil {
+			break
+		}
+		if errors.Is(err, ErrAlreadyRunning) {
+			return false, err
+		}
+
+		delay = min(delay*2, maxReconnectDelay)
+		log.Printf("再接続に失敗しました（%v後に再試行します）: %v", delay, err)
+	}
+
+	r.startEventLoops()
+
+	// キーの割り当てとアクティブウィンドウの監視は新しい接続でやり直す
+	r.mu.Lock()
+	keymap, onActiveWindow := r.keymap, r.onActiveWindow
+	r.mu.Unlock()
+
+	if keymap != nil {
+		if err := r.BindKeys(keymap); err != nil {
+			log.Printf("一部のキーを割り当てられませんでした: %v", err)
+		}
+	}
+	if onActiveWindow != nil {
+		if err := r.WatchActiveWindow(onActiveWindow); err != nil {
+			log.Printf("アクティブウィンドウを監視できません: %v", err)
+		}
+	}
+
+	log.Println("Xサーバーに再接続しました")
+	return true, nil
+}
+
+// redial 新しい接続を開いて古い接続と差し替え、ウィンドウなどを作り直す
+func (r *Ruler) redial(ctx context.Context) error {
+	conn, err := dial(ctx)
+	if err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	// 古い接続で作ったウィンドウや軌跡はXサーバー側で消えているため、忘れるだけにする
+	r.conn.close()
+	r.setConnection(conn)
+	r.windows = nil
+	r.resources.Reset()
+	r.drawnX, r.drawnY = -1, -1
+	r.instanceWin = xproto.WindowNone
+
+	return r.setup()
+}
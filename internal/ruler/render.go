@@ -0,0 +1,28 @@
+package ruler
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"math"
+)
+
+// Render カーソル位置でのモードの表示を、モニターの大きさの画像に描く
+// Layoutの矩形を不透明度を反映した色で透明な背景に塗る（X接続を使わない）
+func Render(mode Mode, cursorX, cursorY int, monitor Monitor) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, monitor.Width, monitor.Height))
+	alpha := uint8(math.Round(min(100, max(0, mode.GetOpacity())) / 100 * 0xff))
+
+	for _, r := range mode.Layout(cursorX, cursorY, monitor) {
+		fill := image.NewUniform(color.NRGBA{
+			R: uint8(r.Color >> 16),
+			G: uint8(r.Color >> 8),
+			B: uint8(r.Color),
+			A: alpha,
+		})
+		bounds := image.Rect(r.X-monitor.X, r.Y-monitor.Y, r.X-monitor.X+r.Width, r.Y-monitor.Y+r.Height)
+		draw.Draw(img, bounds, fill, image.Point{}, draw.Over)
+	}
+
+	return img
+}
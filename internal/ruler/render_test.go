@@ -0,0 +1,118 @@
+package ruler
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// update golden PNGを現在の描画結果で作り直す
+//
+//	go test ./internal/ruler/ -run TestRenderGolden -update
+var update = flag.Bool("update", false, "testdata のgolden PNGを作り直す")
+
+var (
+	goldenMonitor      = Monitor{X: 0, Y: 0, Width: 320, Height: 240}
+	goldenRightMonitor = Monitor{X: 320, Y: 0, Width: 200, Height: 150}
+	goldenRulerConfig  = RulerModeConfig{RulerHeight: 30, RulerColor: 0x808080, OpacityPercent: 50}
+	goldenHideConfig   = HideModeConfig{
+		HideHeight:     60,
+		HideWidth:      150,
+		CursorHeight:   20,
+		BorderHeight:   2,
+		OverlayColor:   0xf0f0f0,
+		BorderColor:    0x000000,
+		OpacityPercent: 100,
+	}
+)
+
+func TestRenderGolden(t *testing.T) {
+	tests := []struct {
+		name    string
+		mode    Mode
+		x       int
+		y       int
+		monitor Monitor
+	}{
+		{name: "ruler_center", mode: goldenRulerConfig, x: 160, y: 120, monitor: goldenMonitor},
+		{name: "ruler_top", mode: goldenRulerConfig, x: 160, y: 3, monitor: goldenMonitor},
+		{name: "ruler_bottom", mode: goldenRulerConfig, x: 160, y: 239, monitor: goldenMonitor},
+		{name: "ruler_right_monitor", mode: goldenRulerConfig, x: 400, y: 60, monitor: goldenRightMonitor},
+		{name: "hide_center", mode: goldenHideConfig, x: 200, y: 120, monitor: goldenMonitor},
+		{name: "hide_top", mode: goldenHideConfig, x: 200, y: 15, monitor: goldenMonitor},
+		{name: "hide_left", mode: goldenHideConfig, x: 60, y: 120, monitor: goldenMonitor},
+		{name: "hide_right_monitor", mode: goldenHideConfig, x: 400, y: 100, monitor: goldenRightMonitor},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := Render(tt.mode, tt.x, tt.y, tt.monitor)
+			assertGolden(t, filepath.Join("testdata", tt.name+".png"), got)
+		})
+	}
+}
+
+// assertGolden 画像をgolden PNGと比べる（-update の場合は書き出す）
+func assertGolden(t *testing.T, path string, got *image.RGBA) {
+	t.Helper()
+
+	if *update {
+		var buf bytes.Buffer
+		if err := png.Encode(&buf, got); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, buf.Bytes(), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatalf("%v（-update で作成してください）", err)
+	}
+	defer f.Close()
+	want, err := png.Decode(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := diffImage(got, want); err != nil {
+		t.Errorf("%s: %v（意図した変更なら -update で作り直してください）", path, err)
+	}
+}
+
+// diffImage 2つの画像の大きさと各ピクセルの色を比べる
+// PNGはアルファを乗算しない色で保存されるため、乗算しない色に直して比べる
+func diffImage(got *image.RGBA, want image.Image) error {
+	if got.Bounds() != want.Bounds() {
+		return fmt.Errorf("大きさ = %v, want %v", got.Bounds(), want.Bounds())
+	}
+
+	var diffs int
+	var first image.Point
+	bounds := got.Bounds()
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			if color.NRGBAModel.Convert(got.At(x, y)) != color.NRGBAModel.Convert(want.At(x, y)) {
+				if diffs == 0 {
+					first = image.Pt(x, y)
+				}
+				diffs++
+			}
+		}
+	}
+	if diffs > 0 {
+		return fmt.Errorf("%dピクセルが異なります（最初は %v: %v, want %v）", diffs, first, got.At(first.X, first.Y), want.At(first.X, first.Y))
+	}
+	return nil
+}
@@ -1,297 +1,475 @@
 package ruler
 
 import (
+	"context"
+	"fmt"
 	"log"
+	"slices"
 	"sync"
 	"time"
 
 	"github.com/BurntSushi/xgb"
-	"github.com/BurntSushi/xgb/shape"
-	"github.com/BurntSushi/xgb/xfixes"
 	"github.com/BurntSushi/xgb/xproto"
 	"github.com/BurntSushi/xgbutil"
 	"github.com/BurntSushi/xgbutil/keybind"
 	"github.com/BurntSushi/xgbutil/xevent"
-	"github.com/BurntSushi/xgbutil/xwindow"
+	"github.com/kijimaD/xruler/internal/argb"
+	"github.com/kijimaD/xruler/internal/backend"
+	"github.com/kijimaD/xruler/internal/resource"
 	"github.com/kijimaD/xruler/internal/trail"
+	"github.com/kijimaD/xruler/internal/xerror"
 )
 
 const (
-	PollInterval    = 16 * time.Millisecond    // カーソル位置のポーリング間隔（約60fps）
-	xfixesMajor     = 6                        // XFixes拡張のメジャーバージョン
-	xfixesMinor     = 0                        // XFixes拡張のマイナーバージョン
-	extensionXFIXES = "XFIXES"                 // XFixes拡張の名前
-	atomOpacity     = "_NET_WM_WINDOW_OPACITY" // ウィンドウ不透明度を設定するアトム名
+	PollInterval     = 16 * time.Millisecond // カーソル位置のポーリング間隔（約60fps）
+	IdlePollInterval = 50 * time.Millisecond // カーソル静止時のポーリング間隔の上限（動き出しの遅れを約3フレームに抑える）
+	idleThreshold    = 30                    // 静止とみなすまでの連続未移動回数（約0.5秒）
 )
 
 // Ruler X Window System上でカーソル位置を追従する水平ルーラー
 type Ruler struct {
-	xConn        *xgb.Conn         // X11プロトコル接続
-	xuConn       *xgbutil.XUtil    // xgbutilユーティリティ接続
-	windows      []*xwindow.Window // ウィンドウリスト
-	screenWidth  int               // 画面の幅
-	screenHeight int               // 画面の高さ
-	mode         Mode              // 動作モード
-	visible      bool              // 表示状態
-	trailMgr     *trail.Manager    // 軌跡管理
-	mu           sync.Mutex        // ウィンドウ操作の排他制御
+	conn     *connection      // Xサーバーへの接続（切断の検知と再接続に使う）
+	xConn    *xgb.Conn        // X11プロトコル接続
+	xuConn   *xgbutil.XUtil   // xgbutilユーティリティ接続
+	mainDone chan struct{}    // xuConnのイベントループが終わると閉じる
+	motion   chan struct{}    // XInput2でカーソルの移動が届くと通知される（nilならポーリングする）
+	screen   *argb.Screen     // ウィンドウを作るビジュアル
+	backend  backend.Backend  // ウィンドウの操作先
+	windows  []backend.Window // ウィンドウリスト
+	monitors []Monitor        // モニター一覧
+	monitor  Monitor          // カーソルがあるモニター
+	mode     Mode             // 動作モード
+	modes    []Mode           // 切り替え対象のモード一覧（先頭から順に巡回する）
+	defaults []Mode           // 設定から作ったモード一覧（実行中の不透明度や高さの変更を含まない）
+	modeIdx  int              // modes内の現在のモードの位置
+	pinned   bool             // ウィンドウをカーソルに追従させない
+	drawnX   int              // ウィンドウを最後に合わせたカーソル位置（-1なら未更新）
+	drawnY   int              // ウィンドウを最後に合わせたカーソル位置（-1なら未更新）
+	quit     chan struct{}    // Runを終了させる
+	quitOnce sync.Once        // quitを一度だけ閉じる
+	closed   bool             // cleanup済み（以降ウィンドウを作らない）
+
+	instanceWin xproto.Window      // 単一起動のセレクションを所有する、このプロセスが作ったウィンドウ
+	forwardWin  xproto.Window      // 起動済みのxrulerのウィンドウ（コマンドの転送先、破棄しない）
+	visible     bool               // 表示状態
+	trailMgr    *trail.Manager     // 軌跡管理
+	trailCfg    trail.Config       // 軌跡の設定
+	resources   *resource.Tracker  // 作成したX資源の記録
+	xerrors     *xerror.Dispatcher // 応答を待たないリクエストのXエラーの振り分け先
+	mu          sync.Mutex         // ウィンドウ操作の排他制御
+
+	keymap         map[string]string // 割り当て中のキーマップ（再接続時に割り当て直す）
+	onActiveWindow func(WindowInfo)  // アクティブウィンドウの監視先（再接続時に監視し直す）
+
+	forwarded  []string   // 転送されたまま実行していないコマンド（届いた順）
+	forwarding bool       // forwardedを実行するゴルーチンが動いている
+	forwardMu  sync.Mutex // forwardedとforwardingの排他制御
 }
 
 // New ルーラーを作成
-func New(mode Mode) *Ruler {
+// modesの先頭のモードで開始し、NextModeで順に切り替える
+func New(modes []Mode, trailConfig trail.Config) *Ruler {
+	resources := resource.NewTracker()
 	return &Ruler{
-		mode:    mode,
-		visible: true,
+		mode:      modes[0],
+		modes:     modes,
+		defaults:  slices.Clone(modes),
+		quit:      make(chan struct{}),
+		visible:   true,
+		drawnX:    -1,
+		drawnY:    -1,
+		trailCfg:  trailConfig,
+		resources: resources,
+		xerrors:   xerror.NewDispatcher(resources, xerror.DefaultInterval),
 	}
 }
 
 // Close X接続を閉じる
 func (r *Ruler) Close() {
-	if r.xConn != nil {
-		r.xConn.Close()
+	if r.conn != nil {
+		r.conn.close()
 	}
 }
 
 // Run メインループ：カーソル位置を追従してウィンドウ位置を更新
-func (r *Ruler) Run() {
-	var lastY int = -1
+// カーソル位置はXInput2の移動イベントが届いた時に確かめ、XInput2がなければポーリングする。
+// ctxがキャンセルされるか quit アクションが実行されると、作成したX資源を片付けて戻る。
+// X接続が切れた場合は再接続できるまで待ち、ウィンドウなどを作り直して続ける
+func (r *Ruler) Run(ctx context.Context) error {
+	prevX, prevY := -1, -1
+	idleCount := 0
 
-	go xevent.Main(r.xuConn)
+	r.startEventLoops()
+	defer r.cleanup()
 
 	for {
 		// カーソル位置を取得
-		cx, cy := r.getCursor()
-
-		// 位置が変わった時のみ更新（不要な描画を削減）
-		if cy != lastY {
-			r.mu.Lock()
-			if r.visible && len(r.windows) > 0 {
-				r.mode.UpdateWindows(r.xConn, r.windows, cx, cy, r.screenWidth, r.screenHeight)
+		cx, cy, err := r.getCursor()
+		if err != nil {
+			if !r.conn.lost() {
+				return err
+			}
+			if ok, err := r.reconnect(ctx); !ok {
+				return err
 			}
-			r.mu.Unlock()
-			lastY = cy
+			prevX, prevY, idleCount = -1, -1, 0
+			continue
+		}
+
+		// 静止が続いた回数を数える（ポーリング間隔の調整に使う）
+		if cx == prevX && cy == prevY {
+			idleCount++
+		} else {
+			idleCount = 0
+		}
+		prevX, prevY = cx, cy
+
+		r.mu.Lock()
+		r.follow(cx, cy)
+		trailActive := r.trailMgr.Active()
+		r.mu.Unlock()
+
+		if !r.waitNext(ctx, time.Now(), idleCount, trailActive) {
+			return nil
+		}
+	}
+}
+
+// follow カーソル位置に合わせてウィンドウを動かし、軌跡を追加・削除する
+// 呼び出し側で r.mu をロックしておくこと
+func (r *Ruler) follow(cx, cy int) {
+	// 固定中はウィンドウを元のモニターに残す
+	if !r.pinned {
+		r.followMonitor(cx, cy)
+	}
+
+	// 位置が変わった時のみ更新（不要な描画を削減）
+	// 横方向の移動では、X座標に追従するモード（隠すモード）だけを更新する
+	moved := cy != r.drawnY || (r.mode.FollowsX() && cx != r.drawnX)
+	if moved && !r.pinned {
+		if r.visible && len(r.windows) > 0 {
+			r.mode.UpdateWindows(r.backend, r.windows, cx, cy, r.monitor)
 		}
+		r.drawnX, r.drawnY = cx, cy
+	}
 
-		// カーソルが移動したら軌跡を追加
-		lastX, lastY := r.trailMgr.GetLastPosition()
-		if cx != lastX || cy != lastY {
-			if r.visible && lastX != -1 && lastY != -1 {
-				if r.trailMgr.ShouldAdd(cx, cy) {
-					r.trailMgr.Add(lastX, lastY, cx, cy)
-				}
+	// カーソルが移動したら軌跡を追加（軌跡を表示しないモードでは位置だけを追う）
+	lastX, lastY := r.trailMgr.GetLastPosition()
+	if cx != lastX || cy != lastY {
+		if r.visible && r.mode.ShowTrail() && lastX != -1 && lastY != -1 {
+			if r.trailMgr.ShouldAdd(cx, cy) {
+				r.trailMgr.Add(lastX, lastY, cx, cy)
 			}
-			r.trailMgr.UpdatePosition(cx, cy)
 		}
+		r.trailMgr.UpdatePosition(cx, cy)
+	}
+
+	r.trailMgr.Update()
+}
+
+// followMonitor カーソルが別のモニターへ移っていれば、そのモニターでウィンドウを作り直す
+// 隠すモードの枠線やルーラーの代わりの形はモニターの大きさで作るため、位置を変えるだけでは合わない
+// 呼び出し側で r.mu をロックしておくこと
+func (r *Ruler) followMonitor(cx, cy int) {
+	if r.monitor.Contains(cx, cy) {
+		return
+	}
+	r.monitor = monitorAt(r.monitors, cx, cy)
+	r.drawnX, r.drawnY = -1, -1
 
-		r.trailMgr.Update()
-		time.Sleep(PollInterval)
+	if !r.visible || len(r.windows) == 0 {
+		// 非表示中は再表示時にそのモニターで作り直される
+		return
+	}
+	if err := r.rebuildWindows(); err != nil {
+		log.Printf("ウィンドウ再作成エラー: %v", err)
 	}
 }
 
-// Init ルーラーの初期化：X接続の確立とウィンドウの設定
-func (r *Ruler) Init() error {
-	var err error
+// cleanup 作成したウィンドウ・軌跡・キーグラブを解放し、イベントループを止める
+func (r *Ruler) cleanup() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
 
-	// xgbutilユーティリティ接続を確立
-	r.xuConn, err = xgbutil.NewConn()
-	if err != nil {
-		return err
+	r.destroyWindows()
+
+	if r.trailMgr != nil {
+		r.trailMgr.Clear()
 	}
 
-	// X11プロトコル接続を確立
-	r.xConn, err = xgb.NewConn()
-	if err != nil {
-		return err
+	if r.backend != nil {
+		r.backend.UngrabKeys()
+	}
+	if r.screen != nil {
+		r.screen.Free()
+	}
+	if r.instanceWin != xproto.WindowNone {
+		xproto.DestroyWindow(r.xuConn.Conn(), r.instanceWin)
+		r.resources.Remove(uint32(r.instanceWin))
+		r.instanceWin = xproto.WindowNone
 	}
+	xevent.Quit(r.xuConn)
+	r.closed = true
+
 	r.xConn.Sync()
+	r.xuConn.Sync()
+	// 間隔が空くのを待っている省略数を、終了前に記録する
+	r.xerrors.Flush()
 
-	// 画面サイズを取得
-	r.screenWidth, r.screenHeight = r.getScreenSize()
+	log.Println("終了しました")
+}
 
-	// 軌跡マネージャを初期化
-	r.trailMgr = trail.NewManager(r.xConn, r.xuConn)
+// pollInterval XInput2が使えない場合の、次のポーリングまでの待ち時間を返す
+// カーソルが静止している間は間隔を徐々に延ばし、不要なウェイクアップを減らす。
+// 静止後の最初の移動が遅れないよう、延ばすのは IdlePollInterval までにとどめる。
+// 軌跡が残っている間は消去を遅らせないよう通常間隔を保つ
+func pollInterval(idleCount int, trailActive bool) time.Duration {
+	if trailActive || idleCount < idleThreshold {
+		return PollInterval
+	}
 
-	// 上下2つのウィンドウを作成
-	if err := r.createWindows(); err != nil {
+	interval := PollInterval
+	for i := idleThreshold; i < idleCount && interval < IdlePollInterval; i++ {
+		interval *= 2
+	}
+	return min(interval, IdlePollInterval)
+}
+
+// Init ルーラーの初期化：X接続の確立とウィンドウの設定
+// ctxをキャンセルすると接続を待たずに戻る
+func (r *Ruler) Init(ctx context.Context) error {
+	conn, err := dial(ctx)
+	if err != nil {
 		return err
 	}
+	r.setConnection(conn)
 
-	// クリックスルー設定（ルーラーがマウスクリックを邪魔しないようにする）
-	if err := r.setupClickThrough(); err != nil {
+	return r.setup()
+}
+
+// setup 接続したXサーバー上にウィンドウ・軌跡・イベントの購読を用意する
+// 再接続時は呼び出し側で r.mu をロックしておくこと
+func (r *Ruler) setup() error {
+	// 同じ画面で既に動いていれば、ここで ErrAlreadyRunning を返す
+	if err := r.claimInstance(); err != nil {
 		return err
 	}
 
-	// 透明度を設定
-	if err := r.setupTransparency(); err != nil {
+	// コンポジットマネージャの有無に合わせて描画するビジュアルを選ぶ
+	if err := r.openScreen(); err != nil {
 		return err
 	}
 
-	// キーボードイベントの設定
-	if err := r.setupKeyboard(); err != nil {
+	// モニター構成を取得し、カーソルがあるモニターを選ぶ
+	r.monitors = queryMonitors(r.xConn)
+	cx, cy, err := r.getCursor()
+	if err != nil {
 		return err
 	}
+	r.monitor = monitorAt(r.monitors, cx, cy)
 
-	return nil
-}
+	// 軌跡マネージャを初期化（再接続時は新しい接続に付け替える）
+	if r.trailMgr == nil {
+		r.trailMgr = trail.NewManager(r.backend, r.trailCfg)
+	} else {
+		r.trailMgr.Reset(r.backend)
+	}
+	r.trailMgr.SetFading(r.screen.Composited())
 
-// setupKeyboard キーボードイベントを設定
-func (r *Ruler) setupKeyboard() error {
-	// keybindを初期化
-	keybind.Initialize(r.xuConn)
+	// 非表示中は再表示時に作成される
+	if r.visible {
+		// 上下2つのウィンドウを作成
+		if err := r.createWindows(); err != nil {
+			return err
+		}
 
-	// ルートウィンドウでグローバルにキーをキャプチャ
-	err := keybind.KeyPressFun(
-		func(X *xgbutil.XUtil, e xevent.KeyPressEvent) {
-			r.toggleVisibility()
-		}).Connect(r.xuConn, r.xuConn.RootWin(), "Control-Shift-space", true)
+		// クリックスルー設定（ルーラーがマウスクリックを邪魔しないようにする）
+		if err := r.setupClickThrough(); err != nil {
+			return err
+		}
 
-	if err != nil {
-		return err
+		// 透明度を設定
+		if err := r.setupTransparency(); err != nil {
+			return err
+		}
 	}
 
-	log.Println("キーバインド設定完了: Ctrl+Shift+Space でトグル")
+	// カーソルの移動をイベントで受け取る（XInput2がない場合はポーリングする）
+	if err := r.setupMotion(); err != nil {
+		log.Printf("XInput2が使えないため、カーソル位置をポーリングで取得します: %v", err)
+	}
+
+	// コンポジットマネージャの起動・終了を監視（XFixesがない場合は起動時の状態のまま動かす）
+	if err := r.setupCompositorNotify(); err != nil {
+		log.Printf("コンポジットマネージャの起動・終了を監視できません: %v", err)
+	}
+
+	// 画面構成の変更を監視（RandRがない場合は起動時の構成のまま動かす）
+	if err := r.setupScreenChangeNotify(); err != nil {
+		log.Printf("画面構成の変更を監視できません: %v", err)
+	}
+
+	// キーボードイベントを受け取れるようにする（キーの割り当ては BindKeys で行う）
+	keybind.Initialize(r.xuConn)
 
 	return nil
 }
 
-// toggleVisibility 表示状態を切り替え（表示時は再作成）
-func (r *Ruler) toggleVisibility() {
-	go func() {
-		r.mu.Lock()
-		defer r.mu.Unlock()
-
-		r.visible = !r.visible
+// Reload 設定ファイルを読み直した時に、モードと軌跡の設定を差し替えてウィンドウを作り直す
+// 現在のモードがmodesに残っていればそのまま使い、なければmodesの先頭のモードに切り替わる
+// 実行中に変えた不透明度や高さは、設定のその値が変わっていなければ引き継ぐ
+func (r *Ruler) Reload(modes []Mode, trailConfig trail.Config) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
 
-		if r.visible {
-			// 既存のウィンドウを破棄
-			for _, win := range r.windows {
-				win.Unmap()
-				win.Destroy()
-			}
+	merged := make([]Mode, len(modes))
+	for i, mode := range modes {
+		merged[i] = r.keepOverrides(mode)
+	}
 
-			// 軌跡マネージャをクリーンアップ
-			if r.trailMgr != nil {
-				r.trailMgr.Clear()
-			}
+	idx := slices.IndexFunc(merged, func(m Mode) bool { return m.Name() == r.mode.Name() })
+	if idx < 0 {
+		idx = 0
+	}
 
-			r.xConn.Sync()
+	if r.replaceModes(modes, merged, idx, trailConfig) {
+		log.Println("設定を再読み込みしました")
+	}
+}
 
-			// ウィンドウを再作成
-			if err := r.createWindows(); err != nil {
-				log.Printf("ウィンドウ再作成エラー: %v", err)
-				return
-			}
+// SwitchProfile プロファイルを切り替えた時に、モードと軌跡の設定を差し替えてウィンドウを作り直す
+// modesの先頭のモードから始め、前のプロファイルで実行中に変えた値は引き継がない
+func (r *Ruler) SwitchProfile(modes []Mode, trailConfig trail.Config) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
 
-			// クリックスルー再設定
-			if err := r.setupClickThrough(); err != nil {
-				log.Printf("クリックスルー再設定エラー: %v", err)
-				return
-			}
+	r.replaceModes(modes, slices.Clone(modes), 0, trailConfig)
+}
 
-			// 透明度を再設定
-			if err := r.setupTransparency(); err != nil {
-				log.Printf("透明度再設定エラー: %v", err)
-				return
-			}
+// replaceModes 設定から作ったモード一覧defaultsと、実際に使うモード一覧modesに差し替え、
+// modes[idx]のモードでウィンドウを作り直す。ウィンドウを作り直した場合はtrueを返す
+// 呼び出し側で r.mu をロックしておくこと
+func (r *Ruler) replaceModes(defaults, modes []Mode, idx int, trailConfig trail.Config) bool {
+	r.defaults = slices.Clone(defaults)
+	r.modes = modes
+	r.modeIdx = idx
+	r.mode = modes[idx]
+	r.trailCfg = trailConfig
+	if r.trailMgr != nil {
+		r.trailMgr.Clear()
+		r.trailMgr.SetConfig(trailConfig)
+	}
 
-			// 現在のカーソル位置でウィンドウを更新
-			cx, cy := r.getCursor()
-			if cx != -1 && cy != -1 {
-				r.mode.UpdateWindows(r.xConn, r.windows, cx, cy, r.screenWidth, r.screenHeight)
-			}
+	if !r.visible {
+		// 非表示中は再表示時に新しい設定で作り直される
+		return false
+	}
 
-			log.Println("ルーラー表示: ON")
-		} else {
-			for _, win := range r.windows {
-				win.Unmap()
-			}
-			log.Println("ルーラー表示: OFF")
-		}
-	}()
+	if err := r.rebuildWindows(); err != nil {
+		log.Printf("ウィンドウ再作成エラー: %v", err)
+		return false
+	}
+	return true
 }
 
-func (r *Ruler) createWindows() error {
-	var err error
-
-	r.windows, err = r.mode.CreateWindows(r.xuConn, r.screenWidth, r.screenHeight)
-	if err != nil {
-		return err
+// keepOverrides 新しい設定のモードに、実行中に変えた不透明度と高さを引き継ぐ
+// 設定のその値が前回の設定から変わった場合は、新しい設定の値を使う
+// 呼び出し側で r.mu をロックしておくこと
+func (r *Ruler) keepOverrides(mode Mode) Mode {
+	byName := func(m Mode) bool { return m.Name() == mode.Name() }
+	i := slices.IndexFunc(r.defaults, byName)
+	j := slices.IndexFunc(r.modes, byName)
+	if i < 0 || j < 0 {
+		return mode
 	}
+	prev, current := r.defaults[i], r.modes[j]
 
-	r.xConn.Sync()
-	return nil
+	if mode.Height() == prev.Height() {
+		mode = mode.Resize(current.Height() - mode.Height())
+	}
+	if mode.GetOpacity() == prev.GetOpacity() {
+		mode = mode.WithOpacity(current.GetOpacity())
+	}
+	return mode
 }
 
-func (r *Ruler) getScreenSize() (int, int) {
-	setup := xproto.Setup(r.xConn)
-	screen := setup.DefaultScreen(r.xConn)
-	return int(screen.WidthInPixels), int(screen.HeightInPixels)
+// destroyWindows モードのウィンドウを隠して破棄する
+// 呼び出し側で r.mu をロックしておくこと
+func (r *Ruler) destroyWindows() {
+	for _, win := range r.windows {
+		r.backend.UnmapWindow(win)
+		r.backend.DestroyWindow(win)
+	}
+	r.windows = nil
 }
 
-func (r *Ruler) setupClickThrough() error {
-	extension, err := xproto.QueryExtension(r.xConn, uint16(len(extensionXFIXES)), extensionXFIXES).Reply()
-	if err != nil || !extension.Present {
-		return err
+// rebuildWindows 既存のウィンドウを破棄し、現在のモードとモニターで作り直す
+// 呼び出し側で r.mu をロックしておくこと
+func (r *Ruler) rebuildWindows() error {
+	if r.closed {
+		return nil
 	}
 
-	if err := xfixes.Init(r.xConn); err != nil {
+	// 既存のウィンドウを破棄
+	r.destroyWindows()
+
+	r.backend.Flush()
+
+	// カーソルがあるモニターを選び直す
+	cx, cy, err := r.getCursor()
+	if err != nil {
 		return err
 	}
+	r.monitor = monitorAt(r.monitors, cx, cy)
 
-	if _, err := xfixes.QueryVersion(r.xConn, xfixesMajor, xfixesMinor).Reply(); err != nil {
+	// ウィンドウを再作成
+	if err := r.createWindows(); err != nil {
 		return err
 	}
 
-	region, err := xfixes.NewRegionId(r.xConn)
-	if err != nil {
+	// クリックスルー再設定
+	if err := r.setupClickThrough(); err != nil {
 		return err
 	}
-	defer xfixes.DestroyRegion(r.xConn, region)
 
-	if err := xfixes.CreateRegionChecked(r.xConn, region, []xproto.Rectangle{{}}).Check(); err != nil {
+	// 透明度を再設定
+	if err := r.setupTransparency(); err != nil {
 		return err
 	}
 
-	for _, win := range r.windows {
-		winID := xproto.Window(win.Id)
-		if err := xfixes.SetWindowShapeRegionChecked(r.xConn, winID, shape.SkInput, 0, 0, region).Check(); err != nil {
-			return err
-		}
+	// 現在のカーソル位置でウィンドウを更新
+	if cx != -1 && cy != -1 {
+		r.mode.UpdateWindows(r.backend, r.windows, cx, cy, r.monitor)
 	}
 
 	return nil
 }
 
-func (r *Ruler) setupTransparency() error {
-	atom, err := xproto.InternAtom(r.xConn, true, uint16(len(atomOpacity)), atomOpacity).Reply()
+func (r *Ruler) createWindows() error {
+	var err error
+
+	r.windows, err = r.mode.CreateWindows(r.backend, r.monitor)
 	if err != nil {
 		return err
 	}
 
-	opacityPercent := r.mode.GetOpacity()
-	maxOpacity := float64(uint32(0xFFFFFFFF))
-	opacity := opacityPercent / 100.0 * maxOpacity
-	opacityValue := uint32(opacity)
+	r.backend.Flush()
+	return nil
+}
 
-	opacityBytes := []byte{
-		byte(opacityValue & 0xFF),
-		byte((opacityValue >> 8) & 0xFF),
-		byte((opacityValue >> 16) & 0xFF),
-		byte((opacityValue >> 24) & 0xFF),
+func (r *Ruler) setupClickThrough() error {
+	for _, win := range r.windows {
+		if err := r.backend.SetClickThrough(win); err != nil {
+			return err
+		}
 	}
 
+	return nil
+}
+
+func (r *Ruler) setupTransparency() error {
 	for _, win := range r.windows {
-		winID := xproto.Window(win.Id)
-		if err := xproto.ChangePropertyChecked(
-			r.xConn,
-			xproto.PropModeReplace,
-			winID,
-			atom.Atom,
-			xproto.AtomCardinal,
-			32,
-			1,
-			opacityBytes,
-		).Check(); err != nil {
+		if err := r.backend.SetOpacity(win, r.mode.GetOpacity()); err != nil {
 			return err
 		}
 	}
@@ -299,14 +477,11 @@ func (r *Ruler) setupTransparency() error {
 	return nil
 }
 
-func (r *Ruler) getCursor() (int, int) {
-	setup := xproto.Setup(r.xConn)
-	root := setup.DefaultScreen(r.xConn).Root
-
-	reply, err := xproto.QueryPointer(r.xConn, root).Reply()
+func (r *Ruler) getCursor() (int, int, error) {
+	x, y, err := r.backend.QueryPointer()
 	if err != nil {
-		log.Fatal(err)
+		return -1, -1, fmt.Errorf("カーソル位置の取得に失敗しました: %w", err)
 	}
 
-	return int(reply.RootX), int(reply.RootY)
+	return x, y, nil
 }
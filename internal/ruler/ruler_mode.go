@@ -1,17 +1,15 @@
 package ruler
 
-import (
-	"github.com/BurntSushi/xgb"
-	"github.com/BurntSushi/xgb/xproto"
-	"github.com/BurntSushi/xgbutil"
-	"github.com/BurntSushi/xgbutil/xwindow"
-)
+import "github.com/kijimaD/xruler/internal/backend"
 
 // RulerModeConfig ルーラーモードの設定
 type RulerModeConfig struct {
 	RulerHeight    int     // ルーラーの高さ（ピクセル）
 	RulerColor     uint32  // ルーラーの色
+	Feather        int     // 上下の端をぼかす幅（ピクセル、ARGBビジュアルの場合のみ）
+	Fallback       string  // コンポジットマネージャがない時の描き方（solid, stipple, outline）
 	OpacityPercent float64 // ウィンドウの不透明度（パーセント: 0-100）
+	Trail          bool    // カーソルの軌跡を表示するか
 }
 
 // DefaultRulerModeConfig デフォルトのルーラーモード設定
@@ -19,49 +17,94 @@ func DefaultRulerModeConfig() RulerModeConfig {
 	return RulerModeConfig{
 		RulerHeight:    60,
 		RulerColor:     0x808080,
+		Feather:        0,
+		Fallback:       backend.FallbackStipple,
 		OpacityPercent: 50,
+		Trail:          true,
 	}
 }
 
+// Name モード名を返す
+func (c RulerModeConfig) Name() string {
+	return "ruler"
+}
+
 // GetOpacity 不透明度を返す
 func (c RulerModeConfig) GetOpacity() float64 {
 	return c.OpacityPercent
 }
 
-// CreateWindows ウィンドウを作成
-func (c RulerModeConfig) CreateWindows(xuConn *xgbutil.XUtil, screenWidth, screenHeight int) ([]*xwindow.Window, error) {
-	windows := make([]*xwindow.Window, 1)
+// WithOpacity 不透明度を変えたモードを返す
+func (c RulerModeConfig) WithOpacity(percent float64) Mode {
+	c.OpacityPercent = percent
+	return c
+}
+
+// FollowsX ルーラーはモニターの幅いっぱいに表示するため、X座標には追従しない
+func (c RulerModeConfig) FollowsX() bool {
+	return false
+}
+
+// ShowTrail カーソルの軌跡を表示するかを返す
+func (c RulerModeConfig) ShowTrail() bool {
+	return c.Trail
+}
+
+// Height ルーラーの高さを返す
+func (c RulerModeConfig) Height() int {
+	return c.RulerHeight
+}
 
-	topWin, err := xwindow.Generate(xuConn)
+// Resize ルーラーの高さを変えたモードを返す
+func (c RulerModeConfig) Resize(delta int) Mode {
+	c.RulerHeight = max(1, c.RulerHeight+delta)
+	return c
+}
+
+// CreateWindows ウィンドウを作成
+// 半透明にできない環境では、下の文字が読めるようFallbackに従って間引いて表示する。
+// 間引く形は作成時の大きさで作るため、幅の違うモニターへ移る時は作り直すこと
+func (c RulerModeConfig) CreateWindows(b backend.Backend, monitor Monitor) ([]backend.Window, error) {
+	topWin, err := b.CreateWindow(backend.WindowSpec{
+		Rect:     backend.Rect{X: monitor.X, Y: monitor.Y, Width: monitor.Width, Height: c.RulerHeight},
+		Color:    c.RulerColor,
+		Feather:  c.Feather,
+		Fallback: c.Fallback,
+		Owner:    c.Name(),
+	})
 	if err != nil {
 		return nil, err
 	}
-	if err := topWin.CreateChecked(
-		xuConn.RootWin(),
-		0, 0,
-		screenWidth, c.RulerHeight,
-		xproto.CwBackPixel|xproto.CwOverrideRedirect,
-		c.RulerColor,
-		1,
-	); err != nil {
-		return nil, err
-	}
-	windows[0] = topWin
 
-	topWin.Map()
+	b.MapWindow(topWin)
 
-	return windows, nil
+	return []backend.Window{topWin}, nil
+}
+
+// Layout カーソル位置を中心とするルーラーの帯を返す
+// 帯の端や模様がずれないよう高さは保ち、モニターの上下の端では帯をモニター内に収める
+func (c RulerModeConfig) Layout(cursorX, cursorY int, monitor Monitor) []Rect {
+	height := min(c.RulerHeight, monitor.Height)
+	y := cursorY - c.RulerHeight/2
+	y = max(monitor.Y, min(y, monitor.Y+monitor.Height-height))
+
+	return clipRects(monitor, Rect{
+		X:      monitor.X,
+		Y:      y,
+		Width:  monitor.Width,
+		Height: height,
+		Color:  c.RulerColor,
+		Role:   RoleRuler,
+	})
 }
 
 // UpdateWindows カーソル位置に応じてウィンドウを更新
-func (c RulerModeConfig) UpdateWindows(xConn *xgb.Conn, windows []*xwindow.Window, cursorX, cursorY, screenWidth, screenHeight int) {
+func (c RulerModeConfig) UpdateWindows(b backend.Backend, windows []backend.Window, cursorX, cursorY int, monitor Monitor) {
 	topWin := windows[0]
-	rulerY := cursorY - c.RulerHeight/2
 
-	topID := xproto.Window(topWin.Id)
-	xproto.ConfigureWindow(xConn, topID,
-		xproto.ConfigWindowX|xproto.ConfigWindowY|xproto.ConfigWindowWidth|xproto.ConfigWindowHeight,
-		[]uint32{0, uint32(rulerY), uint32(screenWidth), uint32(c.RulerHeight)})
+	for _, rect := range c.Layout(cursorX, cursorY, monitor) {
+		b.ConfigureWindow(topWin, backend.Rect{X: rect.X, Y: rect.Y, Width: rect.Width, Height: rect.Height})
+	}
 
-	xConn.Sync()
+	b.Flush()
 }
@@ -0,0 +1,479 @@
+package ruler
+
+import (
+	"errors"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kijimaD/xruler/internal/backend"
+	"github.com/kijimaD/xruler/internal/trail"
+)
+
+// newTestRuler Xサーバーの代わりにFakeを使うルーラーを作り、ウィンドウを表示する
+func newTestRuler(t *testing.T, modes ...Mode) (*Ruler, *backend.Fake) {
+	t.Helper()
+
+	fake := backend.NewFake()
+	fake.SetPointer(100, 500, nil)
+
+	r := New(modes, trail.DefaultConfig())
+	r.backend = fake
+	r.monitors = []Monitor{testMonitor, testRightMonitor}
+	r.monitor = testMonitor
+	r.trailMgr = trail.NewManager(fake, r.trailCfg)
+
+	if err := r.rebuildWindows(); err != nil {
+		t.Fatal(err)
+	}
+	return r, fake
+}
+
+// mapped 表示中のウィンドウを返す
+func mapped(fake *backend.Fake) []backend.Window {
+	var windows []backend.Window
+	for _, win := range fake.Live() {
+		if w, _ := fake.Window(win); w.Mapped {
+			windows = append(windows, win)
+		}
+	}
+	return windows
+}
+
+func TestRebuildWindows(t *testing.T) {
+	r, fake := newTestRuler(t, testRulerConfig)
+
+	win, _ := fake.Window(r.windows[0])
+	if !win.ClickThrough {
+		t.Error("クリックスルーが設定されていない")
+	}
+	if win.Opacity != testRulerConfig.GetOpacity() {
+		t.Errorf("不透明度 = %g, want %g", win.Opacity, testRulerConfig.GetOpacity())
+	}
+	// 作り直した直後からカーソル位置に置く
+	if want := (backend.Rect{X: 0, Y: 470, Width: 1920, Height: 60}); win.Rect != want {
+		t.Errorf("Rect = %+v, want %+v", win.Rect, want)
+	}
+}
+
+func TestToggleVisibility(t *testing.T) {
+	r, fake := newTestRuler(t, testRulerConfig)
+	first := r.windows[0]
+
+	r.ToggleVisibility()
+	if got := mapped(fake); len(got) != 0 {
+		t.Errorf("非表示にしても表示中のウィンドウ = %v", got)
+	}
+
+	// 再表示では、別のモニターに移ったカーソルの位置で作り直す
+	fake.SetPointer(2000, 300, nil)
+	r.ToggleVisibility()
+
+	if got := fake.Live(); len(got) != 1 || got[0] == first {
+		t.Fatalf("再表示後のウィンドウ = %v（最初のウィンドウ %d は破棄する）", got, first)
+	}
+	win, _ := fake.Window(r.windows[0])
+	if !win.Mapped {
+		t.Error("再表示したウィンドウが表示されていない")
+	}
+	if want := (backend.Rect{X: 1920, Y: 270, Width: 1280, Height: 60}); win.Rect != want {
+		t.Errorf("Rect = %+v, want %+v", win.Rect, want)
+	}
+}
+
+func TestNextMode(t *testing.T) {
+	r, fake := newTestRuler(t, testRulerConfig, testHideConfig)
+
+	r.NextMode()
+	if r.mode.Name() != testHideConfig.Name() {
+		t.Fatalf("モード = %s, want %s", r.mode.Name(), testHideConfig.Name())
+	}
+	if got := fake.Live(); len(got) != 2 {
+		t.Errorf("隠すモードのウィンドウ = %v, want 2つ", got)
+	}
+
+	r.NextMode()
+	if r.mode.Name() != testRulerConfig.Name() {
+		t.Fatalf("最後のモードの次は先頭に戻る: モード = %s", r.mode.Name())
+	}
+	if got := fake.Live(); len(got) != 1 {
+		t.Errorf("ルーラーモードのウィンドウ = %v, want 1つ", got)
+	}
+}
+
+func TestNextModeHidden(t *testing.T) {
+	r, fake := newTestRuler(t, testRulerConfig, testHideConfig)
+
+	r.ToggleVisibility()
+	fake.ResetCalls()
+	r.NextMode()
+
+	// 非表示中はウィンドウを作らず、再表示時に新しいモードで作る
+	for _, call := range fake.Calls() {
+		if strings.HasPrefix(call, "CreateWindow") {
+			t.Fatalf("非表示中にウィンドウを作った: %q", fake.Calls())
+		}
+	}
+
+	r.ToggleVisibility()
+	if got := mapped(fake); len(got) != 2 {
+		t.Errorf("再表示後のウィンドウ = %v, want 2つ", got)
+	}
+}
+
+func TestTogglePin(t *testing.T) {
+	r, fake := newTestRuler(t, testRulerConfig)
+
+	r.TogglePin()
+	if !r.pinned {
+		t.Fatal("固定されていない")
+	}
+
+	// 固定を解除すると現在のカーソル位置へ移す
+	fake.SetPointer(100, 800, nil)
+	r.TogglePin()
+
+	win, _ := fake.Window(r.windows[0])
+	if want := (backend.Rect{X: 0, Y: 770, Width: 1920, Height: 60}); win.Rect != want {
+		t.Errorf("Rect = %+v, want %+v", win.Rect, want)
+	}
+}
+
+func TestAdjustOpacity(t *testing.T) {
+	config := testRulerConfig
+	config.OpacityPercent = 95
+	r, fake := newTestRuler(t, config)
+
+	r.AdjustOpacity(opacityStep)
+	win, _ := fake.Window(r.windows[0])
+	if win.Opacity != 100 {
+		t.Errorf("不透明度 = %g, want 100（上限で止める）", win.Opacity)
+	}
+
+	r.AdjustOpacity(-opacityStep)
+	win, _ = fake.Window(r.windows[0])
+	if win.Opacity != 90 {
+		t.Errorf("不透明度 = %g, want 90", win.Opacity)
+	}
+}
+
+func TestBindKeys(t *testing.T) {
+	r, fake := newTestRuler(t, testRulerConfig)
+	grabErr := errors.New("グラブ済み")
+	fake.GrabErrs["Control-g"] = grabErr
+
+	err := r.BindKeys(map[string]string{
+		"Control-a": ActionToggle,
+		"Control-b": "unknown",
+		"Control-c": ActionNone,
+		"Control-g": ActionPin,
+	})
+	if !errors.Is(err, grabErr) || !strings.Contains(err.Error(), "unknown") {
+		t.Errorf("err = %v, want グラブの失敗と不明なアクション", err)
+	}
+
+	if got := fake.Keys(); !slices.Equal(got, []string{"Control-a"}) {
+		t.Errorf("割り当てたキー = %v, want [Control-a]", got)
+	}
+
+	// 割り当て直すと以前のキーは解除される
+	if err := r.BindKeys(map[string]string{"Control-d": ActionToggle}); err != nil {
+		t.Fatal(err)
+	}
+	if got := fake.Keys(); !slices.Equal(got, []string{"Control-d"}) {
+		t.Errorf("割り当てたキー = %v, want [Control-d]", got)
+	}
+}
+
+// TestFollowHorizontal 横方向だけの移動でも隠すモードの領域が追従する
+func TestFollowHorizontal(t *testing.T) {
+	r, fake := newTestRuler(t, testHideConfig)
+
+	r.follow(1500, 540)
+	r.follow(1200, 540)
+
+	border, _ := fake.Window(r.windows[0])
+	want := []backend.Rect{
+		{X: 200, Y: 500, Width: 1000, Height: 2},
+		{X: 200, Y: 578, Width: 1000, Height: 2},
+	}
+	if !reflect.DeepEqual(border.Shape, want) {
+		t.Errorf("枠線の形 = %+v, want %+v", border.Shape, want)
+	}
+}
+
+// TestFollowTrail 軌跡はモードごとの設定に従って追加する
+func TestFollowTrail(t *testing.T) {
+	hide := testHideConfig
+	hide.Trail = false
+	ruler := testRulerConfig
+	ruler.Trail = true
+	r, fake := newTestRuler(t, hide, ruler)
+
+	r.follow(100, 500)
+	r.follow(300, 500)
+	if r.trailMgr.Active() {
+		t.Errorf("軌跡を表示しないモードで軌跡を追加した: %d", r.trailMgr.Len())
+	}
+
+	// 切り替えた後は、前のモードでの位置から線を引かない
+	r.NextMode()
+	r.follow(310, 500)
+	r.follow(320, 500)
+	if r.trailMgr.Len() != 1 {
+		t.Fatalf("軌跡の数 = %d, want 1", r.trailMgr.Len())
+	}
+	for _, win := range fake.Live() {
+		if w, _ := fake.Window(win); w.Spec.Line != nil && w.Spec.Rect.X < 300 {
+			t.Errorf("前のモードの位置から線を引いた: %+v", w.Spec.Rect)
+		}
+	}
+
+	// 軌跡の設定で無効にした場合は、モードの設定にかかわらず追加しない
+	trailCfg := r.trailCfg
+	trailCfg.Enabled = false
+	r.Reload([]Mode{hide, ruler}, trailCfg)
+	r.follow(330, 500)
+	r.follow(400, 500)
+	if r.mode.Name() != ruler.Name() || r.trailMgr.Active() {
+		t.Errorf("モード = %s, 軌跡の数 = %d, want ruler, 0", r.mode.Name(), r.trailMgr.Len())
+	}
+}
+
+// TestFollowHorizontalRuler ルーラーモードは横方向だけの移動ではウィンドウを動かさない
+func TestFollowHorizontalRuler(t *testing.T) {
+	r, fake := newTestRuler(t, testRulerConfig)
+
+	r.follow(100, 540)
+	fake.ResetCalls()
+	r.follow(900, 540)
+
+	for _, call := range fake.Calls() {
+		if strings.HasPrefix(call, "ConfigureWindow") {
+			t.Fatalf("横方向の移動でウィンドウを更新した: %q", fake.Calls())
+		}
+	}
+}
+
+func TestFollowPinned(t *testing.T) {
+	r, fake := newTestRuler(t, testRulerConfig)
+
+	r.TogglePin()
+	fake.ResetCalls()
+	r.follow(100, 800)
+
+	for _, call := range fake.Calls() {
+		if strings.HasPrefix(call, "ConfigureWindow") {
+			t.Fatalf("固定中にウィンドウを動かした: %q", fake.Calls())
+		}
+	}
+}
+
+// TestFollowMonitorFallback 間引いて表示するルーラーは、移った先のモニターの幅で作り直す
+func TestFollowMonitorFallback(t *testing.T) {
+	mode := testRulerConfig
+	mode.Fallback = backend.FallbackStipple
+	r, fake := newTestRuler(t, mode)
+	old := r.windows[0]
+
+	fake.SetPointer(2000, 300, nil)
+	r.follow(2000, 300)
+
+	if w, _ := fake.Window(old); !w.Destroyed {
+		t.Error("前のモニターのウィンドウを破棄していない")
+	}
+	win, _ := fake.Window(r.windows[0])
+	if win.Spec.Fallback != backend.FallbackStipple || win.Spec.Rect.Width != testRightMonitor.Width {
+		t.Errorf("作成時の指定 = %+v, want 幅 %d で間引く", win.Spec, testRightMonitor.Width)
+	}
+	if want := (backend.Rect{X: 1920, Y: 270, Width: 1280, Height: 60}); win.Rect != want {
+		t.Errorf("Rect = %+v, want %+v", win.Rect, want)
+	}
+}
+
+// TestFollowMonitorHide 隠すモードは、移った先のモニターを覆うウィンドウを切り抜く
+func TestFollowMonitorHide(t *testing.T) {
+	r, fake := newTestRuler(t, testHideConfig)
+
+	fake.SetPointer(2000, 300, nil)
+	r.follow(2000, 300)
+
+	border, _ := fake.Window(r.windows[0])
+	overlay, _ := fake.Window(r.windows[1])
+	if want := (backend.Rect{X: 1920, Y: 0, Width: 1280, Height: 1024}); overlay.Rect != want {
+		t.Errorf("オーバーレイの Rect = %+v, want %+v", overlay.Rect, want)
+	}
+	if want := (backend.Rect{Width: 1280, Height: 1024}); border.Rect != want {
+		t.Errorf("枠線の Rect = %+v, want %+v", border.Rect, want)
+	}
+	// カーソルの左側（モニター内の座標で0から80）だけを隠す
+	if len(overlay.Shape) == 0 {
+		t.Fatal("オーバーレイを切り抜いていない")
+	}
+	for _, rect := range overlay.Shape {
+		if rect.X != 0 || rect.Width != 2000-testRightMonitor.X {
+			t.Errorf("オーバーレイの形 = %+v, want X=0 Width=%d", rect, 2000-testRightMonitor.X)
+		}
+	}
+}
+
+// TestFollowMonitorPinned 固定中は元のモニターに残し、固定を解いた時に移る
+func TestFollowMonitorPinned(t *testing.T) {
+	r, fake := newTestRuler(t, testHideConfig)
+	old := slices.Clone(r.windows)
+
+	r.TogglePin()
+	fake.SetPointer(2000, 300, nil)
+	r.follow(2000, 300)
+	if r.monitor != testMonitor || !slices.Equal(r.windows, old) {
+		t.Fatalf("固定中に別のモニターへ移った: %+v", r.monitor)
+	}
+
+	r.TogglePin()
+	if overlay, _ := fake.Window(r.windows[1]); overlay.Rect.X != testRightMonitor.X {
+		t.Errorf("固定を解いた後のオーバーレイの Rect = %+v, want X=%d", overlay.Rect, testRightMonitor.X)
+	}
+}
+
+// TestExecSet set は現在の状態によらず指定した値にする
+func TestExecSet(t *testing.T) {
+	r, fake := newTestRuler(t, testRulerConfig)
+
+	for _, args := range [][]string{
+		{"set", "visible", "true"},
+		{"set", "pinned", "off"},
+		{"set", "opacity", "40"},
+		{"set", "opacity", "40"},
+	} {
+		if _, err := r.Exec(args); err != nil {
+			t.Fatalf("%v: %v", args, err)
+		}
+	}
+
+	status := r.Status()
+	if !status.Visible || status.Pinned || status.Opacity != 40 {
+		t.Errorf("状態 = %+v, want 表示中・固定なし・不透明度40", status)
+	}
+	if win, _ := fake.Window(r.windows[0]); !win.Mapped || win.Opacity != 40 {
+		t.Errorf("ウィンドウ = %+v, want 表示中・不透明度40", win)
+	}
+}
+
+// TestQueueForwarded 転送されたコマンドは、届いた順に1つずつ実行する
+func TestQueueForwarded(t *testing.T) {
+	r, _ := newTestRuler(t, testRulerConfig, testHideConfig)
+
+	r.queueForwarded([]string{"toggle", "mode hide", "set opacity 10"})
+	r.queueForwarded([]string{"set opacity 20", "toggle"})
+
+	deadline := time.Now().Add(time.Second)
+	for {
+		r.forwardMu.Lock()
+		done := !r.forwarding
+		r.forwardMu.Unlock()
+		if done {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("転送されたコマンドを実行し終えない")
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	if r.mode.Name() != testHideConfig.Name() || r.mode.GetOpacity() != 20 || !r.visible {
+		t.Errorf("モード = %s, 不透明度 = %g, 表示 = %v, want hide, 20, true",
+			r.mode.Name(), r.mode.GetOpacity(), r.visible)
+	}
+}
+
+func TestPollInterval(t *testing.T) {
+	tests := []struct {
+		idleCount   int
+		trailActive bool
+		want        time.Duration
+	}{
+		{idleCount: 0, want: PollInterval},
+		{idleCount: idleThreshold - 1, want: PollInterval},
+		{idleCount: idleThreshold + 1, want: 2 * PollInterval},
+		{idleCount: idleThreshold + 100, want: IdlePollInterval},
+		{idleCount: idleThreshold + 100, trailActive: true, want: PollInterval},
+	}
+
+	for _, tt := range tests {
+		if got := pollInterval(tt.idleCount, tt.trailActive); got != tt.want {
+			t.Errorf("pollInterval(%d, %v) = %v, want %v", tt.idleCount, tt.trailActive, got, tt.want)
+		}
+	}
+}
+
+// TestReloadKeepsOverrides 再読み込みでは、実行中に変えたモード・不透明度・高さを引き継ぐ
+func TestReloadKeepsOverrides(t *testing.T) {
+	rulerMode := testRulerConfig
+	rulerMode.OpacityPercent = 50
+	hide := testHideConfig
+	hide.OpacityPercent = 80
+	r, fake := newTestRuler(t, rulerMode, hide)
+
+	r.NextMode()
+	r.AdjustOpacity(-opacityStep)
+	r.Resize(10)
+	r.TogglePin()
+
+	r.Reload([]Mode{rulerMode, hide}, r.trailCfg)
+	if r.mode.Name() != hide.Name() || !r.pinned {
+		t.Fatalf("モード = %s, 固定 = %v, want hide, 固定したまま", r.mode.Name(), r.pinned)
+	}
+	if r.mode.GetOpacity() != 70 || r.mode.Height() != hide.CursorHeight+10 {
+		t.Errorf("不透明度 = %g, 高さ = %d, want 70, %d", r.mode.GetOpacity(), r.mode.Height(), hide.CursorHeight+10)
+	}
+	if win, _ := fake.Window(r.windows[1]); win.Opacity != 70 {
+		t.Errorf("ウィンドウの不透明度 = %g, want 70", win.Opacity)
+	}
+
+	// 設定の値が変わった項目だけ新しい値にする
+	changed := hide
+	changed.OpacityPercent = 30
+	r.Reload([]Mode{rulerMode, changed}, r.trailCfg)
+	if r.mode.GetOpacity() != 30 || r.mode.Height() != hide.CursorHeight+10 {
+		t.Errorf("不透明度 = %g, 高さ = %d, want 30, %d", r.mode.GetOpacity(), r.mode.Height(), hide.CursorHeight+10)
+	}
+
+	// モードの順番が変わっても、現在のモードを名前で引き継ぐ
+	r.Reload([]Mode{changed, rulerMode}, r.trailCfg)
+	if r.mode.Name() != hide.Name() || r.modeIdx != 0 {
+		t.Errorf("モード = %s（%d番目）, want hide（0番目）", r.mode.Name(), r.modeIdx)
+	}
+
+	// 現在のモードがなくなった場合は、先頭のモードに切り替える
+	r.Reload([]Mode{rulerMode}, r.trailCfg)
+	if r.mode.Name() != rulerMode.Name() {
+		t.Errorf("モード = %s, want ruler", r.mode.Name())
+	}
+}
+
+// TestSwitchProfile プロファイルの切り替えでは、そのプロファイルの最初のモードから始める
+func TestSwitchProfile(t *testing.T) {
+	hide := testHideConfig
+	hide.OpacityPercent = 80
+	r, fake := newTestRuler(t, testRulerConfig, hide)
+
+	r.AdjustOpacity(-opacityStep)
+	r.Resize(10)
+
+	r.SwitchProfile([]Mode{hide, testRulerConfig}, r.trailCfg)
+	if r.mode.Name() != hide.Name() || r.modeIdx != 0 {
+		t.Fatalf("モード = %s（%d番目）, want hide（0番目）", r.mode.Name(), r.modeIdx)
+	}
+	if win, _ := fake.Window(r.windows[0]); win.Opacity != 80 {
+		t.Errorf("ウィンドウの不透明度 = %g, want 80", win.Opacity)
+	}
+
+	// 前のプロファイルで変えた値は引き継がない
+	r.NextMode()
+	if r.mode.GetOpacity() != testRulerConfig.GetOpacity() || r.mode.Height() != testRulerConfig.Height() {
+		t.Errorf("不透明度 = %g, 高さ = %d, want %g, %d", r.mode.GetOpacity(), r.mode.Height(),
+			testRulerConfig.GetOpacity(), testRulerConfig.Height())
+	}
+}
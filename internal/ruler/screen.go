@@ -0,0 +1,81 @@
+package ruler
+
+import (
+	"log"
+	"time"
+
+	"github.com/BurntSushi/xgb"
+	"github.com/BurntSushi/xgb/randr"
+	"github.com/BurntSushi/xgb/xfixes"
+	"github.com/BurntSushi/xgb/xproto"
+	"github.com/kijimaD/xruler/internal/xconn"
+)
+
+// screenChangeDelay 画面構成の変更通知をまとめるための待ち時間
+// xrandrによる回転や解像度変更では複数の通知が立て続けに届くため、落ち着いてから再構成する
+const screenChangeDelay = 200 * time.Millisecond
+
+// setupScreenChangeNotify RandRの画面構成変更通知を購読
+func (r *Ruler) setupScreenChangeNotify() error {
+	if err := randr.Init(r.xConn); err != nil {
+		return err
+	}
+
+	root := xproto.Setup(r.xConn).DefaultScreen(r.xConn).Root
+	return randr.SelectInputChecked(r.xConn, root,
+		randr.NotifyMaskScreenChange|randr.NotifyMaskCrtcChange|randr.NotifyMaskOutputChange).Check()
+}
+
+// handleEvents xConnに届くイベントを処理する
+func (r *Ruler) handleEvents(conn *xconn.Conn) {
+	var timer *time.Timer
+
+	for {
+		ev, err := conn.WaitForEvent()
+		if ev == nil && err == nil {
+			// 接続が閉じられた
+			return
+		}
+		if err != nil {
+			// 切断後のエラーは再接続で解消されるため記録しない
+			if conn.IsLost() {
+				continue
+			}
+			if xerr, ok := err.(xgb.Error); ok {
+				r.xerrors.Handle(xerr)
+			} else {
+				log.Printf("Xエラー: %v", err)
+			}
+			continue
+		}
+
+		switch ev.(type) {
+		case randr.ScreenChangeNotifyEvent, randr.NotifyEvent:
+			if timer == nil {
+				timer = time.AfterFunc(screenChangeDelay, r.refreshMonitors)
+			} else {
+				timer.Reset(screenChangeDelay)
+			}
+		case xfixes.SelectionNotifyEvent:
+			r.refreshCompositor()
+		}
+	}
+}
+
+// refreshMonitors モニター構成を取り直し、ウィンドウを作り直す
+func (r *Ruler) refreshMonitors() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.monitors = queryMonitors(r.xConn)
+	log.Printf("画面構成の変更を検出: モニター数 %d", len(r.monitors))
+
+	if !r.visible {
+		// 非表示中は再表示時に作り直される
+		return
+	}
+
+	if err := r.rebuildWindows(); err != nil {
+		log.Printf("ウィンドウ再作成エラー: %v", err)
+	}
+}
@@ -0,0 +1,25 @@
+package trail
+
+import "time"
+
+// Config 軌跡の設定
+type Config struct {
+	Enabled     bool          // 軌跡を表示するか
+	Duration    time.Duration // 軌跡の表示時間
+	MinDistance int           // 軌跡を追加する最小移動距離（ピクセル）
+	LineWidth   int           // 軌跡の線の太さ
+	Color       uint32        // 軌跡の色
+	Fade        string        // 軌跡が消えていく変化の仕方（FadeCurves のいずれか）
+}
+
+// DefaultConfig デフォルトの軌跡設定
+func DefaultConfig() Config {
+	return Config{
+		Enabled:     true,
+		Duration:    2 * time.Second,
+		MinDistance: 1,
+		LineWidth:   8,
+		Color:       0xFF0000,
+		Fade:        FadeLinear,
+	}
+}
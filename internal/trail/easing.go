@@ -0,0 +1,38 @@
+package trail
+
+import "math"
+
+// 軌跡が消えていく変化の仕方
+const (
+	FadeNone      = "none"        // 表示時間が過ぎるまでそのまま表示し、一度に消す
+	FadeLinear    = "linear"      // 一定の速さで薄くする
+	FadeEaseIn    = "ease-in"     // はじめはゆっくり、終わりに向けて速く薄くする
+	FadeEaseOut   = "ease-out"    // はじめに速く、終わりに向けてゆっくり薄くする
+	FadeEaseInOut = "ease-in-out" // はじめと終わりをゆっくり薄くする
+)
+
+// FadeCurves 利用できる変化の仕方の一覧を返す
+func FadeCurves() []string {
+	return []string{FadeNone, FadeLinear, FadeEaseIn, FadeEaseOut, FadeEaseInOut}
+}
+
+// fadeOpacity 表示時間のうちprogress（0-1）が過ぎた軌跡の不透明度（パーセント: 0-100）を返す
+func fadeOpacity(curve string, progress float64) float64 {
+	t := min(1, max(0, progress))
+
+	var eased float64
+	switch curve {
+	case FadeLinear:
+		eased = t
+	case FadeEaseIn:
+		eased = t * t
+	case FadeEaseOut:
+		eased = 1 - (1-t)*(1-t)
+	case FadeEaseInOut:
+		eased = t * t * (3 - 2*t)
+	default:
+		eased = 0
+	}
+
+	return math.Round((1 - eased) * 100)
+}
@@ -4,20 +4,7 @@ import (
 	"log"
 	"time"
 
-	"github.com/BurntSushi/xgb"
-	"github.com/BurntSushi/xgb/shape"
-	"github.com/BurntSushi/xgb/xfixes"
-	"github.com/BurntSushi/xgb/xproto"
-	"github.com/BurntSushi/xgbutil"
-	"github.com/BurntSushi/xgbutil/xwindow"
-)
-
-const (
-	Duration    = 2 * time.Second // 軌跡の表示時間
-	MinDistance = 1               // 軌跡を追加する最小移動距離（ピクセル）
-	LineWidth   = 8               // 軌跡の線の太さ
-	Color       = 0xFF0000        // 軌跡の色（赤）
-	atomOpacity = "_NET_WM_WINDOW_OPACITY"
+	"github.com/kijimaD/xruler/internal/backend"
 )
 
 // Segment 軌跡の線分
@@ -25,225 +12,149 @@ type Segment struct {
 	x1, y1    int
 	x2, y2    int
 	timestamp time.Time
-	window    *xwindow.Window
-	gc        xproto.Gcontext
+	window    backend.Window
+	opacity   float64 // 設定した不透明度（パーセント: 0-100）
 }
 
 // Manager 軌跡管理
 type Manager struct {
-	xConn  *xgb.Conn
-	xuConn *xgbutil.XUtil
-	trails []*Segment
-	lastX  int
-	lastY  int
+	backend backend.Backend
+	config  Config
+	trails  []*Segment
+	lastX   int
+	lastY   int
+	now     func() time.Time // 現在時刻（テストで差し替える）
+	fading  bool             // 軌跡を薄くしていく（falseなら表示時間が過ぎたら一度に消す）
 }
 
 // NewManager 軌跡マネージャを作成
-func NewManager(xConn *xgb.Conn, xuConn *xgbutil.XUtil) *Manager {
+// バックエンドがARGBビジュアルで描く場合は、線をアンチエイリアスして描く
+func NewManager(b backend.Backend, config Config) *Manager {
 	return &Manager{
-		xConn:  xConn,
-		xuConn: xuConn,
-		lastX:  -1,
-		lastY:  -1,
+		backend: b,
+		config:  config,
+		lastX:   -1,
+		lastY:   -1,
+		now:     time.Now,
 	}
 }
 
+// SetConfig 軌跡の設定を差し替える
+func (m *Manager) SetConfig(config Config) {
+	m.config = config
+}
+
+// SetBackend 軌跡のウィンドウを作るバックエンドを差し替える
+func (m *Manager) SetBackend(b backend.Backend) {
+	m.backend = b
+}
+
+// SetFading 軌跡を薄くしていくかを設定する
+// 不透明度はコンポジットマネージャがないと反映されないため、ない場合は false にする
+func (m *Manager) SetFading(fading bool) {
+	m.fading = fading
+}
+
 // ShouldAdd 軌跡を追加すべきか判定
 func (m *Manager) ShouldAdd(x, y int) bool {
-	if m.lastX == -1 || m.lastY == -1 {
+	if !m.config.Enabled || m.lastX == -1 || m.lastY == -1 {
 		return false
 	}
 	dx := x - m.lastX
 	dy := y - m.lastY
 	distance := dx*dx + dy*dy
-	return distance >= MinDistance*MinDistance
+	return distance >= m.config.MinDistance*m.config.MinDistance
 }
 
 // Add 軌跡セグメントを追加
 func (m *Manager) Add(x1, y1, x2, y2 int) {
-	if m.xConn == nil || m.xuConn == nil {
+	if m.backend == nil {
 		return
 	}
 
-	// 線分を囲む矩形を計算
-	minX := min(x1, x2) - 5
-	minY := min(y1, y2) - 5
-	maxX := max(x1, x2) + 5
-	maxY := max(y1, y2) + 5
-	width := maxX - minX
-	height := maxY - minY
-
-	// ウィンドウを生成
-	win, err := xwindow.Generate(m.xuConn)
+	// 線分を囲む矩形を計算（線の太さの分だけ余白を取る）
+	pad := m.config.LineWidth/2 + 1
+	minX := min(x1, x2) - pad
+	minY := min(y1, y2) - pad
+	maxX := max(x1, x2) + pad
+	maxY := max(y1, y2) + pad
+
+	win, err := m.backend.CreateWindow(backend.WindowSpec{
+		Rect: backend.Rect{X: minX, Y: minY, Width: maxX - minX, Height: maxY - minY},
+		Line: &backend.Line{
+			X1: x1 - minX, Y1: y1 - minY,
+			X2: x2 - minX, Y2: y2 - minY,
+			Width: m.config.LineWidth,
+			Color: m.config.Color,
+		},
+		Owner: "trail",
+	})
 	if err != nil {
-		log.Println("軌跡ウィンドウ生成エラー:", err)
-		return
-	}
-
-	if err := win.CreateChecked(
-		m.xuConn.RootWin(),
-		minX, minY,
-		width, height,
-		xproto.CwBackPixel|xproto.CwOverrideRedirect,
-		0xff0000, // 黒背景（SHAPEマスクで隠される）
-		1,
-	); err != nil {
 		log.Println("軌跡ウィンドウ作成エラー:", err)
 		return
 	}
 
-	// GCを作成
-	gc, _ := xproto.NewGcontextId(m.xConn)
-	if err := xproto.CreateGCChecked(
-		m.xConn,
-		gc,
-		xproto.Drawable(win.Id),
-		xproto.GcForeground|xproto.GcLineWidth|xproto.GcCapStyle|xproto.GcJoinStyle,
-		[]uint32{Color, LineWidth, xproto.CapStyleRound, xproto.JoinStyleRound},
-	).Check(); err != nil {
-		log.Println("GC作成エラー:", err)
-		return
+	if err := m.backend.SetClickThrough(win); err != nil {
+		log.Println("軌跡クリックスルー設定エラー:", err)
 	}
 
-	// ウィンドウに直接線を描画
-	xproto.PolyLine(
-		m.xConn,
-		xproto.CoordModeOrigin,
-		xproto.Drawable(win.Id),
-		gc,
-		[]xproto.Point{
-			{X: int16(x1 - minX), Y: int16(y1 - minY)},
-			{X: int16(x2 - minX), Y: int16(y2 - minY)},
-		},
-	)
-
-	// マスクを作成して線の部分だけを表示
-	setup := xproto.Setup(m.xConn)
-	screen := setup.DefaultScreen(m.xConn)
-	maskPixmap, _ := xproto.NewPixmapId(m.xConn)
-	if err := xproto.CreatePixmapChecked(
-		m.xConn,
-		1, // 1-bit depth
-		maskPixmap,
-		xproto.Drawable(screen.Root),
-		uint16(width),
-		uint16(height),
-	).Check(); err != nil {
-		log.Println("マスクPixmap作成エラー:", err)
-		return
-	}
-
-	maskGC, _ := xproto.NewGcontextId(m.xConn)
-	if err := xproto.CreateGCChecked(
-		m.xConn,
-		maskGC,
-		xproto.Drawable(maskPixmap),
-		xproto.GcForeground|xproto.GcBackground,
-		[]uint32{0, 0},
-	).Check(); err != nil {
-		log.Println("マスクGC作成エラー:", err)
-		return
-	}
-
-	// マスクをクリア（透明）
-	xproto.PolyFillRectangle(
-		m.xConn,
-		xproto.Drawable(maskPixmap),
-		maskGC,
-		[]xproto.Rectangle{{X: 0, Y: 0, Width: uint16(width), Height: uint16(height)}},
-	)
-
-	// マスクに線を描画（不透明）
-	xproto.ChangeGC(m.xConn, maskGC, xproto.GcForeground|xproto.GcLineWidth|xproto.GcCapStyle|xproto.GcJoinStyle,
-		[]uint32{1, LineWidth, xproto.CapStyleRound, xproto.JoinStyleRound})
-	xproto.PolyLine(
-		m.xConn,
-		xproto.CoordModeOrigin,
-		xproto.Drawable(maskPixmap),
-		maskGC,
-		[]xproto.Point{
-			{X: int16(x1 - minX), Y: int16(y1 - minY)},
-			{X: int16(x2 - minX), Y: int16(y2 - minY)},
-		},
-	)
-
-	// マスクを適用
-	if err := shape.Init(m.xConn); err != nil {
-		log.Println("Shape拡張初期化エラー:", err)
-		return
-	}
-	shape.Mask(
-		m.xConn,
-		shape.SoSet,
-		shape.SkBounding,
-		xproto.Window(win.Id),
-		0, 0,
-		maskPixmap,
-	)
-
-	xproto.FreeGC(m.xConn, maskGC)
-	xproto.FreePixmap(m.xConn, maskPixmap)
-
-	m.setupWindowClickThrough(win)
-	m.xConn.Sync()
-
 	// クリックスルー設定後にウィンドウを表示
-	win.Map()
+	m.backend.MapWindow(win)
+	m.backend.Flush()
 
-	segment := &Segment{
+	m.trails = append(m.trails, &Segment{
 		x1: x1, y1: y1, x2: x2, y2: y2,
-		timestamp: time.Now(),
+		timestamp: m.now(),
 		window:    win,
-		gc:        gc,
-	}
-
-	m.trails = append(m.trails, segment)
-}
-
-// setupWindowClickThrough 単一ウィンドウのクリックスルーを設定
-func (m *Manager) setupWindowClickThrough(win *xwindow.Window) {
-	region, err := xfixes.NewRegionId(m.xConn)
-	if err != nil {
-		log.Println("軌跡クリックスルー設定エラー(NewRegionId):", err)
-		return
-	}
-	defer xfixes.DestroyRegion(m.xConn, region)
-
-	if err := xfixes.CreateRegionChecked(m.xConn, region, []xproto.Rectangle{{}}).Check(); err != nil {
-		log.Println("軌跡クリックスルー設定エラー(CreateRegion):", err)
-		return
-	}
-
-	winID := xproto.Window(win.Id)
-	if err := xfixes.SetWindowShapeRegionChecked(m.xConn, winID, shape.SkInput, 0, 0, region).Check(); err != nil {
-		log.Println("軌跡クリックスルー設定エラー(SetWindowShapeRegion):", err)
-		return
-	}
+		opacity:   100,
+	})
 }
 
-// Update 軌跡の透明度を更新し、古い軌跡を削除
+// Update 表示時間に応じて軌跡を薄くし、表示時間を過ぎた軌跡を削除
 func (m *Manager) Update() {
-	now := time.Now()
+	now := m.now()
 
 	newTrails := make([]*Segment, 0, len(m.trails))
+	expired := false
+	faded := false
 
 	for _, segment := range m.trails {
 		elapsed := now.Sub(segment.timestamp)
 
-		if elapsed > Duration {
-			// GCを解放
-			xproto.FreeGC(m.xConn, segment.gc)
+		if elapsed > m.config.Duration {
 			// ウィンドウをアンマップしてから破棄
-			segment.window.Unmap()
-			segment.window.Destroy()
+			m.backend.UnmapWindow(segment.window)
+			m.backend.DestroyWindow(segment.window)
+			expired = true
 			continue
 		}
 
+		if m.fade(segment, float64(elapsed)/float64(m.config.Duration)) {
+			faded = true
+		}
 		newTrails = append(newTrails, segment)
 	}
 
 	m.trails = newTrails
-	m.xConn.Sync()
+	if expired || faded {
+		m.backend.Flush()
+	}
+}
+
+// fade 表示時間のうちprogressが過ぎた軌跡の不透明度を変える
+// 不透明度が変わらない場合はリクエストを送らず false を返す
+func (m *Manager) fade(segment *Segment, progress float64) bool {
+	if !m.fading {
+		return false
+	}
+	opacity := fadeOpacity(m.config.Fade, progress)
+	if opacity == segment.opacity {
+		return false
+	}
+
+	m.backend.SetOpacityUnchecked(segment.window, opacity)
+	segment.opacity = opacity
+	return true
 }
 
 // UpdatePosition 最後の位置を更新
@@ -257,14 +168,30 @@ func (m *Manager) GetLastPosition() (int, int) {
 	return m.lastX, m.lastY
 }
 
+// Len 表示中の軌跡の数を返す
+func (m *Manager) Len() int {
+	return len(m.trails)
+}
+
+// Active 表示中の軌跡があるかを返す
+func (m *Manager) Active() bool {
+	return len(m.trails) > 0
+}
+
+// Reset バックエンドを差し替え、表示中の軌跡を忘れる
+// 切れた接続で作ったウィンドウはXサーバー側で消えているため、解放のリクエストは送らない
+func (m *Manager) Reset(b backend.Backend) {
+	m.backend = b
+	m.trails = nil
+	m.lastX = -1
+	m.lastY = -1
+}
+
 // Clear すべての軌跡をクリア
 func (m *Manager) Clear() {
 	for _, segment := range m.trails {
-		if segment.window != nil {
-			xproto.FreeGC(m.xConn, segment.gc)
-			segment.window.Unmap()
-			segment.window.Destroy()
-		}
+		m.backend.UnmapWindow(segment.window)
+		m.backend.DestroyWindow(segment.window)
 	}
 	m.trails = nil
 	m.lastX = -1
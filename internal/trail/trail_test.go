@@ -0,0 +1,166 @@
+package trail
+
+import (
+	"testing"
+	"time"
+
+	"github.com/kijimaD/xruler/internal/backend"
+)
+
+// newTestManager Fakeに軌跡を描くマネージャを作る（時刻はclockで進める）
+func newTestManager(config Config) (*Manager, *backend.Fake, *time.Time) {
+	fake := backend.NewFake()
+	m := NewManager(fake, config)
+	clock := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	m.now = func() time.Time { return clock }
+	return m, fake, &clock
+}
+
+func TestShouldAdd(t *testing.T) {
+	config := DefaultConfig()
+	config.MinDistance = 5
+	m, _, _ := newTestManager(config)
+
+	if m.ShouldAdd(100, 100) {
+		t.Error("最初の位置が決まるまでは追加しない")
+	}
+
+	m.UpdatePosition(100, 100)
+	if m.ShouldAdd(103, 103) {
+		t.Error("最小距離より短い移動で追加した")
+	}
+	if !m.ShouldAdd(103, 104) {
+		t.Error("最小距離の移動で追加しない")
+	}
+
+	m.SetConfig(Config{MinDistance: 5})
+	if m.ShouldAdd(200, 200) {
+		t.Error("無効なのに追加した")
+	}
+}
+
+func TestAdd(t *testing.T) {
+	config := DefaultConfig()
+	config.LineWidth = 4
+	m, fake, _ := newTestManager(config)
+
+	m.Add(110, 20, 100, 30)
+
+	live := fake.Live()
+	if len(live) != 1 {
+		t.Fatalf("ウィンドウ = %v, want 1つ", live)
+	}
+	win, _ := fake.Window(live[0])
+	if !win.Mapped || !win.ClickThrough {
+		t.Errorf("クリックスルーを設定して表示する: %+v", win)
+	}
+
+	// 線の太さの分だけ余白を取った矩形に、ウィンドウ内の座標で線を描く
+	if want := (backend.Rect{X: 97, Y: 17, Width: 16, Height: 16}); win.Spec.Rect != want {
+		t.Errorf("Rect = %+v, want %+v", win.Spec.Rect, want)
+	}
+	want := backend.Line{X1: 13, Y1: 3, X2: 3, Y2: 13, Width: 4, Color: config.Color}
+	if win.Spec.Line == nil || *win.Spec.Line != want {
+		t.Errorf("Line = %+v, want %+v", win.Spec.Line, want)
+	}
+}
+
+func TestUpdateExpires(t *testing.T) {
+	config := DefaultConfig()
+	config.Duration = time.Second
+	m, fake, clock := newTestManager(config)
+
+	m.Add(0, 0, 10, 10)
+	*clock = clock.Add(600 * time.Millisecond)
+	m.Add(10, 10, 20, 20)
+
+	*clock = clock.Add(600 * time.Millisecond)
+	m.Update()
+	if m.Len() != 1 || len(fake.Live()) != 1 {
+		t.Fatalf("表示時間を過ぎた軌跡だけを消す: Len = %d, ウィンドウ = %v", m.Len(), fake.Live())
+	}
+
+	*clock = clock.Add(600 * time.Millisecond)
+	m.Update()
+	if m.Active() || len(fake.Live()) != 0 {
+		t.Errorf("すべての軌跡が消えていない: Len = %d, ウィンドウ = %v", m.Len(), fake.Live())
+	}
+}
+
+func TestFadeOpacity(t *testing.T) {
+	tests := []struct {
+		curve    string
+		progress float64
+		want     float64
+	}{
+		{curve: FadeNone, progress: 0.9, want: 100},
+		{curve: FadeLinear, progress: 0, want: 100},
+		{curve: FadeLinear, progress: 0.25, want: 75},
+		{curve: FadeLinear, progress: 1.5, want: 0},
+		{curve: FadeEaseIn, progress: 0.5, want: 75},
+		{curve: FadeEaseOut, progress: 0.5, want: 25},
+		{curve: FadeEaseInOut, progress: 0.25, want: 84},
+		{curve: FadeEaseInOut, progress: 0.5, want: 50},
+	}
+
+	for _, tt := range tests {
+		if got := fadeOpacity(tt.curve, tt.progress); got != tt.want {
+			t.Errorf("fadeOpacity(%q, %g) = %g, want %g", tt.curve, tt.progress, got, tt.want)
+		}
+	}
+}
+
+func TestUpdateFades(t *testing.T) {
+	config := DefaultConfig()
+	config.Duration = time.Second
+	config.Fade = FadeLinear
+	m, fake, clock := newTestManager(config)
+	m.SetFading(true)
+
+	m.Add(0, 0, 10, 10)
+	win := fake.Live()[0]
+
+	*clock = clock.Add(400 * time.Millisecond)
+	m.Update()
+	if w, _ := fake.Window(win); w.Opacity != 60 {
+		t.Errorf("不透明度 = %g, want 60", w.Opacity)
+	}
+
+	// 不透明度が変わらない間はリクエストを送らない
+	fake.ResetCalls()
+	m.Update()
+	if calls := fake.Calls(); len(calls) != 0 {
+		t.Errorf("不透明度が同じなのにリクエストを送った: %q", calls)
+	}
+
+	m.SetConfig(Config{Enabled: true, Duration: time.Second, Fade: FadeNone})
+	*clock = clock.Add(400 * time.Millisecond)
+	m.Update()
+	if w, _ := fake.Window(win); w.Opacity != 100 {
+		t.Errorf("none の不透明度 = %g, want 100", w.Opacity)
+	}
+
+	// コンポジットマネージャがない場合は不透明度を変えない
+	m.SetConfig(config)
+	m.SetFading(false)
+	fake.ResetCalls()
+	m.Update()
+	if calls := fake.Calls(); len(calls) != 0 {
+		t.Errorf("薄くしないのにリクエストを送った: %q", calls)
+	}
+}
+
+func TestClear(t *testing.T) {
+	m, fake, _ := newTestManager(DefaultConfig())
+
+	m.UpdatePosition(5, 5)
+	m.Add(0, 0, 5, 5)
+	m.Clear()
+
+	if m.Active() || len(fake.Live()) != 0 {
+		t.Errorf("軌跡が残っている: Len = %d, ウィンドウ = %v", m.Len(), fake.Live())
+	}
+	if x, y := m.GetLastPosition(); x != -1 || y != -1 {
+		t.Errorf("最後の位置 = (%d, %d), want (-1, -1)", x, y)
+	}
+}
@@ -0,0 +1,99 @@
+package xconn
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/BurntSushi/xgb"
+)
+
+const (
+	familyLocal = 256   // Xauthorityのローカル接続を表すファミリー
+	familyWild  = 65535 // Xauthorityの任意のアドレスに一致するファミリー
+	authName    = "MIT-MAGIC-COOKIE-1"
+)
+
+// readAuthority Xauthorityから接続先に対応するMIT-MAGIC-COOKIE-1を探す
+// xgbと同じく、ローカルのホスト名か任意のアドレスのエントリーに一致させる
+func readAuthority(host, number string) ([]byte, error) {
+	if host == "" || host == "localhost" {
+		var err error
+		if host, err = os.Hostname(); err != nil {
+			return nil, err
+		}
+	}
+
+	path := os.Getenv("XAUTHORITY")
+	if path == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return nil, err
+		}
+		path = filepath.Join(home, ".Xauthority")
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return findAuthority(bufio.NewReader(f), host, number)
+}
+
+// findAuthority Xauthorityの内容からホストとディスプレイ番号に一致するエントリーの認証情報を返す
+func findAuthority(r io.Reader, host, number string) ([]byte, error) {
+	for {
+		var family uint16
+		if err := binary.Read(r, binary.BigEndian, &family); err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil, errors.New("Xauthorityに接続先の認証情報がありません")
+			}
+			return nil, err
+		}
+
+		var fields [4][]byte
+		for i := range fields {
+			var err error
+			if fields[i], err = readField(r); err != nil {
+				return nil, err
+			}
+		}
+		addr, disp, name, data := string(fields[0]), string(fields[1]), string(fields[2]), fields[3]
+
+		addrMatch := family == familyWild || (family == familyLocal && addr == host)
+		dispMatch := disp == "" || disp == number
+		if addrMatch && dispMatch && name == authName && len(data) == 16 {
+			return data, nil
+		}
+	}
+}
+
+// readField Xauthorityの長さ付きフィールドを1つ読む
+func readField(r io.Reader) ([]byte, error) {
+	var n uint16
+	if err := binary.Read(r, binary.BigEndian, &n); err != nil {
+		return nil, err
+	}
+	b := make([]byte, n)
+	if _, err := io.ReadFull(r, b); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+// setupRequest 認証情報を含む接続要求を組み立てる（リトルエンディアン、X11.0）
+func setupRequest(cookie []byte) []byte {
+	buf := make([]byte, 12+xgb.Pad(len(authName))+xgb.Pad(len(cookie)))
+	buf[0] = 0x6c
+	xgb.Put16(buf[2:], 11)
+	xgb.Put16(buf[6:], uint16(len(authName)))
+	xgb.Put16(buf[8:], uint16(len(cookie)))
+	copy(buf[12:], authName)
+	copy(buf[12+xgb.Pad(len(authName)):], cookie)
+	return buf
+}
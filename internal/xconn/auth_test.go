@@ -0,0 +1,164 @@
+package xconn
+
+import (
+	"bytes"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/BurntSushi/xgb"
+)
+
+var (
+	testCookie  = []byte("0123456789abcdef")
+	otherCookie = []byte("fedcba9876543210")
+)
+
+// authEntry Xauthorityのエントリーを1つ組み立てる
+func authEntry(family uint16, addr, disp, name string, data []byte) []byte {
+	var buf bytes.Buffer
+	binary.Write(&buf, binary.BigEndian, family)
+	for _, field := range [][]byte{[]byte(addr), []byte(disp), []byte(name), data} {
+		binary.Write(&buf, binary.BigEndian, uint16(len(field)))
+		buf.Write(field)
+	}
+	return buf.Bytes()
+}
+
+func TestFindAuthority(t *testing.T) {
+	tests := []struct {
+		name    string
+		entries [][]byte
+		host    string
+		number  string
+		want    []byte
+	}{
+		{
+			name:    "ローカルのホストとディスプレイ番号",
+			entries: [][]byte{authEntry(familyLocal, "myhost", "0", authName, testCookie)},
+			host:    "myhost",
+			number:  "0",
+			want:    testCookie,
+		},
+		{
+			name: "ディスプレイ番号が違うエントリーは飛ばす",
+			entries: [][]byte{
+				authEntry(familyLocal, "myhost", "1", authName, otherCookie),
+				authEntry(familyLocal, "myhost", "0", authName, testCookie),
+			},
+			host:   "myhost",
+			number: "0",
+			want:   testCookie,
+		},
+		{
+			name:    "ディスプレイ番号が空なら任意の番号に一致する",
+			entries: [][]byte{authEntry(familyLocal, "myhost", "", authName, testCookie)},
+			host:    "myhost",
+			number:  "3",
+			want:    testCookie,
+		},
+		{
+			name: "任意のアドレスのファミリーはホストによらず一致する",
+			entries: [][]byte{
+				authEntry(familyLocal, "otherhost", "0", authName, otherCookie),
+				authEntry(familyWild, "", "0", authName, testCookie),
+			},
+			host:   "myhost",
+			number: "0",
+			want:   testCookie,
+		},
+		{
+			name: "ローカル以外のファミリーは一致させない",
+			entries: [][]byte{
+				authEntry(0, "myhost", "0", authName, otherCookie),
+				authEntry(familyLocal, "myhost", "0", authName, testCookie),
+			},
+			host:   "myhost",
+			number: "0",
+			want:   testCookie,
+		},
+		{
+			name: "MIT-MAGIC-COOKIE-1以外と長さが違う認証情報は飛ばす",
+			entries: [][]byte{
+				authEntry(familyLocal, "myhost", "0", "XDM-AUTHORIZATION-1", otherCookie),
+				authEntry(familyLocal, "myhost", "0", authName, []byte("short")),
+				authEntry(familyLocal, "myhost", "0", authName, testCookie),
+			},
+			host:   "myhost",
+			number: "0",
+			want:   testCookie,
+		},
+		{
+			name:    "一致するエントリーがない",
+			entries: [][]byte{authEntry(familyLocal, "otherhost", "0", authName, testCookie)},
+			host:    "myhost",
+			number:  "0",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := findAuthority(bytes.NewReader(bytes.Join(tt.entries, nil)), tt.host, tt.number)
+			if tt.want == nil {
+				if err == nil {
+					t.Errorf("認証情報 = %q, want エラー", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(got, tt.want) {
+				t.Errorf("認証情報 = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFindAuthorityTruncated(t *testing.T) {
+	entry := authEntry(familyLocal, "myhost", "0", authName, testCookie)
+	if _, err := findAuthority(bytes.NewReader(entry[:len(entry)-4]), "myhost", "0"); err == nil {
+		t.Error("途中で切れたファイルでエラーにならない")
+	}
+}
+
+func TestReadAuthority(t *testing.T) {
+	hostname, err := os.Hostname()
+	if err != nil {
+		t.Skip(err)
+	}
+	path := filepath.Join(t.TempDir(), "Xauthority")
+	if err := os.WriteFile(path, authEntry(familyLocal, hostname, "0", authName, testCookie), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("XAUTHORITY", path)
+
+	// ローカル接続はこのマシンのホスト名で探す
+	for _, host := range []string{"", "localhost"} {
+		got, err := readAuthority(host, "0")
+		if err != nil || !bytes.Equal(got, testCookie) {
+			t.Errorf("readAuthority(%q) = %q, %v, want %q", host, got, err, testCookie)
+		}
+	}
+}
+
+func TestSetupRequest(t *testing.T) {
+	buf := setupRequest(testCookie)
+
+	if len(buf) != 12+xgb.Pad(len(authName))+xgb.Pad(len(testCookie)) || len(buf)%4 != 0 {
+		t.Fatalf("長さ = %d", len(buf))
+	}
+	if buf[0] != 0x6c || xgb.Get16(buf[2:]) != 11 {
+		t.Errorf("バイト順とバージョン = %#x, %d", buf[0], xgb.Get16(buf[2:]))
+	}
+	if xgb.Get16(buf[6:]) != uint16(len(authName)) || xgb.Get16(buf[8:]) != uint16(len(testCookie)) {
+		t.Errorf("認証情報の長さ = %d, %d", xgb.Get16(buf[6:]), xgb.Get16(buf[8:]))
+	}
+	if got := string(buf[12 : 12+len(authName)]); got != authName {
+		t.Errorf("認証方式 = %q", got)
+	}
+	if got := buf[12+xgb.Pad(len(authName)):][:len(testCookie)]; !bytes.Equal(got, testCookie) {
+		t.Errorf("認証情報 = %q", got)
+	}
+}
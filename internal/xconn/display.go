@@ -0,0 +1,86 @@
+package xconn
+
+import (
+	"errors"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// display DISPLAY環境変数を解釈した接続先
+type display struct {
+	network string // 接続に使うネットワーク（unix または tcp）
+	address string // 接続先のアドレス
+	host    string // 認証情報を探すためのホスト名（ローカルの場合は空）
+	number  string // ディスプレイ番号
+	screen  int    // 既定の画面番号
+}
+
+// DisplayID 接続先のXサーバーと画面を表す文字列（例: ":1.0", "host:2.1"）を返す
+// 同じXサーバーと画面を指すDISPLAYは同じ文字列になる。nameが空ならDISPLAY環境変数を使う
+func DisplayID(name string) (string, error) {
+	d, err := parseDisplay(name)
+	if err != nil {
+		return "", err
+	}
+	return d.host + ":" + d.number + "." + strconv.Itoa(d.screen), nil
+}
+
+// parseDisplay DISPLAYの文字列を解釈する（xgbと同じ書式に対応する）
+//
+//	":1"                -> unix /tmp/.X11-unix/X1
+//	"/tmp/launch-12/:0" -> unix /tmp/launch-12/:0
+//	"hostname:2.1"      -> tcp hostname:6002（画面1）
+//	"tcp/hostname:1.0"  -> tcp hostname:6001
+func parseDisplay(name string) (display, error) {
+	if name == "" {
+		name = os.Getenv("DISPLAY")
+	}
+	if name == "" {
+		return display{}, errors.New("DISPLAYが設定されていません")
+	}
+	bad := errors.New("DISPLAYの形式が不正です: " + name)
+
+	colon := strings.LastIndex(name, ":")
+	if colon < 0 {
+		return display{}, bad
+	}
+
+	var d display
+	var protocol, socket string
+	if name[0] == '/' {
+		socket = name[:colon]
+	} else if slash := strings.LastIndex(name, "/"); slash >= 0 {
+		protocol = name[:slash]
+		d.host = name[slash+1 : colon]
+	} else {
+		d.host = name[:colon]
+	}
+
+	number, screen, hasScreen := strings.Cut(name[colon+1:], ".")
+	n, err := strconv.Atoi(number)
+	if err != nil || n < 0 {
+		return display{}, bad
+	}
+	d.number = number
+	if hasScreen {
+		if d.screen, err = strconv.Atoi(screen); err != nil {
+			return display{}, bad
+		}
+	}
+
+	switch {
+	case socket != "":
+		d.network, d.address = "unix", socket+":"+number
+	case d.host != "" && d.host != "unix":
+		if protocol == "" {
+			protocol = "tcp"
+		}
+		d.network, d.address = protocol, d.host+":"+strconv.Itoa(6000+n)
+	default:
+		d.host = ""
+		d.network, d.address = "unix", "/tmp/.X11-unix/X"+number
+	}
+
+	return d, nil
+}
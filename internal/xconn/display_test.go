@@ -0,0 +1,79 @@
+package xconn
+
+import "testing"
+
+func TestParseDisplay(t *testing.T) {
+	tests := []struct {
+		name string
+		want display
+	}{
+		{name: ":1", want: display{network: "unix", address: "/tmp/.X11-unix/X1", number: "1"}},
+		{name: ":0.2", want: display{network: "unix", address: "/tmp/.X11-unix/X0", number: "0", screen: 2}},
+		{name: "unix:3", want: display{network: "unix", address: "/tmp/.X11-unix/X3", number: "3"}},
+		{name: "/tmp/launch-12/:0", want: display{network: "unix", address: "/tmp/launch-12/:0", number: "0"}},
+		{name: "hostname:2.1", want: display{network: "tcp", address: "hostname:6002", host: "hostname", number: "2", screen: 1}},
+		{name: "tcp/hostname:1.0", want: display{network: "tcp", address: "hostname:6001", host: "hostname", number: "1"}},
+	}
+
+	for _, tt := range tests {
+		got, err := parseDisplay(tt.name)
+		if err != nil {
+			t.Errorf("parseDisplay(%q): %v", tt.name, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("parseDisplay(%q) = %+v, want %+v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestParseDisplayInvalid(t *testing.T) {
+	for _, name := range []string{"hostname", ":x", ":-1", ":1.y"} {
+		if _, err := parseDisplay(name); err == nil {
+			t.Errorf("parseDisplay(%q) はエラーにならない", name)
+		}
+	}
+
+	t.Setenv("DISPLAY", "")
+	if _, err := parseDisplay(""); err == nil {
+		t.Error("DISPLAYが空でもエラーにならない")
+	}
+}
+
+func TestParseDisplayEnv(t *testing.T) {
+	t.Setenv("DISPLAY", ":7.1")
+
+	got, err := parseDisplay("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.number != "7" || got.screen != 1 {
+		t.Errorf("parseDisplay(\"\") = %+v, want DISPLAYの :7.1", got)
+	}
+}
+
+func TestDisplayID(t *testing.T) {
+	tests := []struct {
+		name string
+		want string
+	}{
+		// 同じ画面を指すDISPLAYは同じ文字列になる
+		{name: ":0", want: ":0.0"},
+		{name: "unix:0.0", want: ":0.0"},
+		{name: "/tmp/launch-12/:0", want: ":0.0"},
+		{name: ":0.1", want: ":0.1"},
+		{name: "hostname:2.1", want: "hostname:2.1"},
+		{name: "tcp/hostname:2.1", want: "hostname:2.1"},
+	}
+
+	for _, tt := range tests {
+		got, err := DisplayID(tt.name)
+		if err != nil {
+			t.Errorf("DisplayID(%q): %v", tt.name, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("DisplayID(%q) = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
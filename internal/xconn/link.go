@@ -0,0 +1,250 @@
+package xconn
+
+import (
+	"io"
+	"net"
+	"sync"
+
+	"github.com/BurntSushi/xgb"
+	"github.com/BurntSushi/xgb/xproto"
+)
+
+const packetSize = 32 // Xサーバーから届くパケットの最小サイズ
+
+// link xgbとXサーバーの間に入るnet.Conn
+//
+// xgbは読み込みエラーが続くとパニックし、切断後に送ったリクエストの応答を永遠に待つ。
+// linkは送ったリクエストと受け取った応答のシーケンス番号を数えておき、切断後は
+// 応答待ちのリクエストすべてにXエラーを合成して返す。これにより切断後も
+// xgbの呼び出しはエラーを返すだけになり、接続を閉じて張り直せる。
+//
+// また、xgbは32バイトを超えるGenericEvent（XInput2などのイベント）を読むと以降の
+// パケットの区切りを見失う。linkはGenericEventをxgbへ渡さずに取り除き、handlerに渡す
+type link struct {
+	net.Conn
+
+	mu     sync.Mutex
+	cond   *sync.Cond
+	setup  []byte // 最初のWriteで送る接続要求（nilならxgbが組み立てたものを送る）
+	ready  bool   // 接続処理が終わり、以降のWriteをリクエストとして数える
+	seq    uint16 // 最後に送ったリクエストのシーケンス番号
+	done   uint16 // 最後に応答（リプライかエラー）を受け取ったシーケンス番号
+	header []byte // 読み込み途中のパケットの先頭部分
+	body   int    // 読み込み途中のリプライかGenericEventの残りバイト数
+	event  []byte // 読み込み途中のGenericEvent
+	inGE   bool   // 読み込み途中のパケットがGenericEvent
+	fake   []byte // 切断後に返す合成データ
+	dead   bool   // 切断を検知した
+	closed bool   // Closeされた
+	lost   chan struct{}
+
+	handler func(ev []byte) // GenericEventを受け取る関数（nilなら捨てる）
+}
+
+func newLink(conn net.Conn, setup []byte) *link {
+	l := &link{
+		Conn:   conn,
+		setup:  setup,
+		header: make([]byte, 0, packetSize),
+		lost:   make(chan struct{}),
+	}
+	l.cond = sync.NewCond(&l.mu)
+	return l
+}
+
+// start 接続処理が終わったことを記録する（以降の送受信でシーケンス番号を数える）
+func (l *link) start() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.ready = true
+}
+
+// Write リクエストを送る
+// 切断後は送らずに成功を返し、Readでそのリクエストへのエラーを返す
+func (l *link) Write(p []byte) (int, error) {
+	l.mu.Lock()
+	if !l.ready {
+		buf := p
+		if l.setup != nil {
+			buf, l.setup = l.setup, nil
+		}
+		l.mu.Unlock()
+		if _, err := l.Conn.Write(buf); err != nil {
+			return 0, err
+		}
+		return len(p), nil
+	}
+
+	// xgbは1回のWriteで1つのリクエストを送る
+	l.seq++
+	if l.dead {
+		l.cond.Broadcast()
+		l.mu.Unlock()
+		return len(p), nil
+	}
+	l.mu.Unlock()
+
+	if _, err := l.Conn.Write(p); err != nil {
+		l.fail()
+	}
+	return len(p), nil
+}
+
+// Read Xサーバーからの応答を読む
+// 切断後はエラーを返さず、応答待ちのリクエストへのXエラーを合成して返す
+func (l *link) Read(p []byte) (int, error) {
+	l.mu.Lock()
+	if !l.ready {
+		l.mu.Unlock()
+		return l.Conn.Read(p)
+	}
+	for !l.dead {
+		l.mu.Unlock()
+		n, err := l.Conn.Read(p)
+		l.mu.Lock()
+		n = l.parse(p[:n])
+		if err != nil {
+			l.markDead()
+		}
+		if n > 0 {
+			l.mu.Unlock()
+			return n, nil
+		}
+	}
+	defer l.mu.Unlock()
+
+	for len(l.fake) == 0 {
+		if l.closed {
+			return 0, io.EOF
+		}
+		l.fake = l.fabricate()
+		if len(l.fake) == 0 {
+			l.cond.Wait()
+		}
+	}
+
+	n := copy(p, l.fake)
+	l.parse(p[:n])
+	l.fake = l.fake[n:]
+	return n, nil
+}
+
+// fabricate 次に返す合成データを作る
+// 読み込み途中のパケットがあればゼロで埋めて完結させ、その後は応答待ちの
+// リクエストに1つずつエラーを返す
+// 呼び出し側で l.mu をロックしておくこと
+func (l *link) fabricate() []byte {
+	// 読み込み途中のGenericEventはxgbへ渡していないため、捨てるだけでよい
+	if l.inGE {
+		l.header, l.body, l.event, l.inGE = l.header[:0], 0, nil, false
+	}
+
+	switch {
+	case len(l.header) > 0:
+		return make([]byte, packetSize-len(l.header))
+	case l.body > 0:
+		return make([]byte, l.body)
+	case l.done != l.seq:
+		buf := make([]byte, packetSize)
+		buf[1] = xproto.BadImplementation
+		xgb.Put16(buf[2:], l.done+1)
+		return buf
+	}
+	return nil
+}
+
+// parse xgbへ渡すデータを追い、応答を受け取ったシーケンス番号を記録する
+// GenericEventはpから取り除いてhandlerに渡し、残りを前に詰めた長さを返す
+// 呼び出し側で l.mu をロックしておくこと
+func (l *link) parse(p []byte) int {
+	kept := 0
+	for b := p; len(b) > 0; {
+		if l.body > 0 {
+			n := min(l.body, len(b))
+			l.body -= n
+			if l.inGE {
+				l.event = append(l.event, b[:n]...)
+				if l.body == 0 {
+					l.deliver()
+				}
+			} else {
+				kept += copy(p[kept:], b[:n])
+			}
+			b = b[n:]
+			continue
+		}
+
+		if len(l.header) == 0 {
+			l.inGE = b[0]&0x7f == xproto.GeGeneric
+		}
+		n := min(packetSize-len(l.header), len(b))
+		l.header = append(l.header, b[:n]...)
+		if !l.inGE {
+			kept += copy(p[kept:], b[:n])
+		}
+		b = b[n:]
+		if len(l.header) < packetSize {
+			break
+		}
+
+		switch {
+		case l.inGE:
+			l.event = append(l.event[:0], l.header...)
+			l.body = int(xgb.Get32(l.header[4:])) * 4
+			if l.body == 0 {
+				l.deliver()
+			}
+		case l.header[0] == 0: // エラー
+			l.done = xgb.Get16(l.header[2:])
+		case l.header[0] == 1: // リプライ
+			l.done = xgb.Get16(l.header[2:])
+			l.body = int(xgb.Get32(l.header[4:])) * 4
+		}
+		l.header = l.header[:0]
+	}
+	return kept
+}
+
+// deliver 読み終えたGenericEventをhandlerに渡す
+// 呼び出し側で l.mu をロックしておくこと
+func (l *link) deliver() {
+	if l.handler != nil {
+		l.handler(l.event)
+	}
+	l.inGE = false
+}
+
+// setHandler GenericEventを受け取る関数を設定する
+func (l *link) setHandler(fn func(ev []byte)) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.handler = fn
+}
+
+// fail 接続を切断済みとして扱い、ソケットを閉じる
+func (l *link) fail() {
+	l.mu.Lock()
+	l.markDead()
+	l.mu.Unlock()
+	l.Conn.Close()
+}
+
+// markDead 切断を記録して待っている読み込みを起こす
+// 呼び出し側で l.mu をロックしておくこと
+func (l *link) markDead() {
+	if l.dead {
+		return
+	}
+	l.dead = true
+	close(l.lost)
+	l.cond.Broadcast()
+}
+
+// Close ソケットを閉じる（xgbが接続を閉じ終えた時に呼ばれる）
+func (l *link) Close() error {
+	l.mu.Lock()
+	l.closed = true
+	l.markDead()
+	l.mu.Unlock()
+	return l.Conn.Close()
+}
@@ -0,0 +1,183 @@
+package xconn
+
+import (
+	"bytes"
+	"io"
+	"net"
+	"testing"
+
+	"github.com/BurntSushi/xgb"
+	"github.com/BurntSushi/xgb/xproto"
+)
+
+// packet シーケンス番号を入れたパケットの先頭32バイトを作る
+func packet(kind byte, seq uint16, length uint32) []byte {
+	buf := make([]byte, packetSize)
+	buf[0] = kind
+	xgb.Put16(buf[2:], seq)
+	xgb.Put32(buf[4:], length)
+	return buf
+}
+
+func TestParse(t *testing.T) {
+	l := newLink(nil, nil)
+
+	// リプライは分割して届いても、追加のデータの後までを1つの応答として数える
+	reply := append(packet(1, 5, 2), make([]byte, 8)...)
+	l.parse(reply[:10])
+	if l.done != 0 {
+		t.Fatalf("途中のパケットで done = %d", l.done)
+	}
+	l.parse(reply[10:36])
+	if l.done != 5 || l.body != 4 {
+		t.Fatalf("done = %d, body = %d, want 5, 4", l.done, l.body)
+	}
+	l.parse(reply[36:])
+	if l.body != 0 || len(l.header) != 0 {
+		t.Fatalf("リプライを読み終えていない: body = %d, header = %d", l.body, len(l.header))
+	}
+
+	// イベントは応答として数えない
+	l.parse(packet(xproto.MapNotify, 9, 0))
+	if l.done != 5 {
+		t.Errorf("イベントで done = %d, want 5", l.done)
+	}
+
+	l.parse(packet(0, 6, 0))
+	if l.done != 6 {
+		t.Errorf("エラーで done = %d, want 6", l.done)
+	}
+}
+
+// TestFabricateWraparound シーケンス番号が16ビットで一周しても、応答待ちのリクエストすべてにエラーを返す
+func TestFabricateWraparound(t *testing.T) {
+	l := newLink(nil, nil)
+	l.done = 0xfffe
+	l.seq = 1 // 0xffff, 0x0000, 0x0001 の3つが応答待ち
+
+	var got []uint16
+	for buf := l.fabricate(); buf != nil; buf = l.fabricate() {
+		if buf[0] != 0 || buf[1] != xproto.BadImplementation {
+			t.Fatalf("合成したパケット = %v, want BadImplementation", buf[:2])
+		}
+		got = append(got, xgb.Get16(buf[2:]))
+		l.parse(buf)
+		if len(got) > 3 {
+			break
+		}
+	}
+
+	want := []uint16{0xffff, 0x0000, 0x0001}
+	if len(got) != len(want) {
+		t.Fatalf("エラーのシーケンス番号 = %#x, want %#x", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("エラーのシーケンス番号 = %#x, want %#x", got, want)
+			break
+		}
+	}
+}
+
+// TestFabricatePartial 読み込み途中のパケットはゼロで埋めて完結させてからエラーを返す
+func TestFabricatePartial(t *testing.T) {
+	l := newLink(nil, nil)
+	l.seq = 1
+	l.parse(packet(1, 0, 1)[:10])
+
+	if buf := l.fabricate(); len(buf) != packetSize-10 {
+		t.Fatalf("ヘッダーの残り = %d バイト, want %d", len(buf), packetSize-10)
+	}
+	l.parse(make([]byte, packetSize-10))
+	if buf := l.fabricate(); len(buf) != 4 {
+		t.Fatalf("リプライの残り = %d バイト, want 4", len(buf))
+	}
+	l.parse(make([]byte, 4))
+	if buf := l.fabricate(); len(buf) != packetSize || xgb.Get16(buf[2:]) != 1 {
+		t.Errorf("エラー = %v, want シーケンス番号1のエラー", buf)
+	}
+}
+
+// TestParseGenericEvent GenericEventは区切りがどこにあってもxgbへ渡さずに取り除き、handlerに渡す
+func TestParseGenericEvent(t *testing.T) {
+	event := packet(xproto.MapNotify, 1, 0)
+	generic := append(packet(xproto.GeGeneric, 1, 2), 1, 2, 3, 4, 5, 6, 7, 8)
+	reply := append(packet(1, 2, 1), 9, 9, 9, 9)
+
+	var stream, want []byte
+	stream = append(append(append(stream, event...), generic...), reply...)
+	want = append(append(want, event...), reply...)
+
+	for split := 1; split < len(stream); split++ {
+		l := newLink(nil, nil)
+		var got [][]byte
+		l.setHandler(func(ev []byte) { got = append(got, bytes.Clone(ev)) })
+
+		first := bytes.Clone(stream[:split])
+		k1 := l.parse(first)
+		second := bytes.Clone(stream[split:])
+		k2 := l.parse(second)
+		out := append(first[:k1], second[:k2]...)
+
+		if !bytes.Equal(out, want) {
+			t.Fatalf("%dバイト目で分割: xgbへ渡すデータ = %v, want %v", split, out, want)
+		}
+		if len(got) != 1 || !bytes.Equal(got[0], generic) {
+			t.Fatalf("%dバイト目で分割: handlerに渡したイベント = %v, want %v", split, got, generic)
+		}
+		if l.done != 2 {
+			t.Errorf("%dバイト目で分割: done = %d, want 2", split, l.done)
+		}
+	}
+}
+
+// TestFabricatePartialGenericEvent 読み込み途中のGenericEventはxgbへ渡していないため、埋めずに捨てる
+func TestFabricatePartialGenericEvent(t *testing.T) {
+	l := newLink(nil, nil)
+	l.seq = 1
+	if n := l.parse(packet(xproto.GeGeneric, 0, 4)[:10]); n != 0 {
+		t.Fatalf("GenericEventの %d バイトをxgbへ渡した", n)
+	}
+
+	if buf := l.fabricate(); len(buf) != packetSize || buf[0] != 0 || xgb.Get16(buf[2:]) != 1 {
+		t.Errorf("合成したパケット = %v, want シーケンス番号1のエラー", buf)
+	}
+}
+
+// TestLinkLost 接続が切れると、応答待ちのリクエストにエラーを返す
+func TestLinkLost(t *testing.T) {
+	client, server := net.Pipe()
+	l := newLink(client, nil)
+	l.start()
+	go io.Copy(io.Discard, server)
+
+	if _, err := l.Write(make([]byte, 4)); err != nil {
+		t.Fatal(err)
+	}
+	server.Close()
+
+	buf := make([]byte, packetSize)
+	if _, err := io.ReadFull(l, buf); err != nil {
+		t.Fatal(err)
+	}
+	if buf[0] != 0 || buf[1] != xproto.BadImplementation || xgb.Get16(buf[2:]) != 1 {
+		t.Errorf("応答 = %v, want シーケンス番号1のBadImplementation", buf[:4])
+	}
+	select {
+	case <-l.lost:
+	default:
+		t.Error("切断を検知していない")
+	}
+
+	// 切断後のリクエストは送らずに、エラーを返す
+	if _, err := l.Write(make([]byte, 4)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := io.ReadFull(l, buf); err != nil {
+		t.Fatal(err)
+	}
+	if xgb.Get16(buf[2:]) != 2 {
+		t.Errorf("シーケンス番号 = %d, want 2", xgb.Get16(buf[2:]))
+	}
+	l.Close()
+}
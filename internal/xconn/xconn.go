@@ -0,0 +1,118 @@
+// Package xconn 切断を検知でき、切断後も呼び出し側を止めないX接続を提供する
+package xconn
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"log"
+	"net"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/BurntSushi/xgb"
+)
+
+// dialTimeout 接続と接続処理（認証とサーバー情報の受け取り）を待つ時間の上限
+const dialTimeout = 5 * time.Second
+
+var quietOnce sync.Once
+
+// Conn 切断を検知できるX接続
+// 切断後のリクエストはXエラー（BadImplementation）で失敗する
+type Conn struct {
+	*xgb.Conn
+	link *link
+}
+
+// Dial DISPLAY環境変数のXサーバーへ接続
+// 応答しないXサーバーで止まらないよう、接続処理は dialTimeout かctxのキャンセルで諦める
+func Dial(ctx context.Context) (*Conn, error) {
+	d, err := parseDisplay("")
+	if err != nil {
+		return nil, err
+	}
+
+	dialer := net.Dialer{Timeout: dialTimeout}
+	netConn, err := dialer.DialContext(ctx, d.network, d.address)
+	if err != nil {
+		return nil, err
+	}
+
+	// 接続要求への応答を待つ間も、時間切れかキャンセルで読み込みを止める
+	netConn.SetDeadline(time.Now().Add(dialTimeout))
+	stop := context.AfterFunc(ctx, func() { netConn.SetDeadline(time.Now()) })
+	defer stop()
+
+	// NewConnNetではxgbが接続先を知らず認証情報を探せないため、接続要求を差し替える
+	quietOnce.Do(quietAuthLog)
+	var setup []byte
+	if cookie, err := readAuthority(d.host, d.number); err == nil {
+		setup = setupRequest(cookie)
+	}
+
+	l := newLink(netConn, setup)
+	xConn, err := xgb.NewConnNet(l)
+	if err != nil {
+		netConn.Close()
+		return nil, err
+	}
+	if !stop() {
+		xConn.Close()
+		return nil, ctx.Err()
+	}
+	netConn.SetDeadline(time.Time{})
+	xConn.DisplayNumber, _ = strconv.Atoi(d.number)
+	xConn.DefaultScreen = d.screen
+	l.start()
+
+	return &Conn{Conn: xConn, link: l}, nil
+}
+
+// Lost 接続が切れると閉じるチャネルを返す
+func (c *Conn) Lost() <-chan struct{} {
+	return c.link.lost
+}
+
+// IsLost 接続が切れているかを返す
+func (c *Conn) IsLost() bool {
+	select {
+	case <-c.link.lost:
+		return true
+	default:
+		return false
+	}
+}
+
+// HandleGenericEvents GenericEvent（XInput2などの拡張が送る可変長のイベント）を受け取る関数を設定する
+// xgbはGenericEventを扱えないため、GenericEventは WaitForEvent には届かず、fnにだけ渡される。
+// fnはXサーバーからの読み込み中に呼ばれるため、すぐに戻ること（evは呼び出しの間だけ有効）
+func (c *Conn) HandleGenericEvents(fn func(ev []byte)) {
+	c.link.setHandler(fn)
+}
+
+// Abandon 応答のない接続を切断済みとして扱う
+// 待っているリクエストはすべてエラーで戻る
+func (c *Conn) Abandon() {
+	c.link.fail()
+}
+
+// quietAuthLog xgbが認証情報を探せなかった時のログを抑える
+// 認証情報は Dial が接続要求に入れ直すため、このログは誤解を招く
+func quietAuthLog() {
+	xgb.Logger = log.New(&authLogFilter{w: os.Stderr}, xgb.Logger.Prefix(), xgb.Logger.Flags())
+}
+
+// authLogFilter 認証情報に関するxgbのログを捨てるWriter
+type authLogFilter struct {
+	w io.Writer
+}
+
+func (f *authLogFilter) Write(p []byte) (int, error) {
+	if bytes.Contains(p, []byte("authority info")) {
+		return len(p), nil
+	}
+	return f.w.Write(p)
+}
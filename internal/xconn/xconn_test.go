@@ -0,0 +1,50 @@
+package xconn
+
+import (
+	"context"
+	"net"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// TestDialCancel 応答しないXサーバーへの接続はctxのキャンセルで諦める
+func TestDialCancel(t *testing.T) {
+	// 接続を受け付けるだけで、接続要求には応答しないサーバー
+	socket := filepath.Join(t.TempDir(), ":0")
+	listener, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Skip(err)
+	}
+	defer listener.Close()
+	accepted := make(chan net.Conn, 4)
+	go func() {
+		defer close(accepted)
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			accepted <- conn
+		}
+	}()
+	defer func() {
+		listener.Close()
+		for conn := range accepted {
+			conn.Close()
+		}
+	}()
+	t.Setenv("DISPLAY", socket)
+	t.Setenv("XAUTHORITY", filepath.Join(t.TempDir(), "none"))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if conn, err := Dial(ctx); err == nil {
+		conn.Close()
+		t.Fatal("応答しないサーバーに接続できた")
+	}
+	if elapsed := time.Since(start); elapsed > dialTimeout/2 {
+		t.Errorf("キャンセルから戻るまで %v かかった", elapsed)
+	}
+}
@@ -0,0 +1,179 @@
+// Package xerror 応答を待たないリクエストのXエラーを一か所で受け取る
+//
+// ConfigureWindow や PolyLine などの応答を待たないリクエストが失敗すると、
+// エラーは後からイベントループに届く。Dispatcher はエラーの原因になった資源を
+// resource.Tracker で引いてサブシステムに振り分け、数を数え、同じエラーが
+// 続く場合は間隔を空けてまとめて記録する
+package xerror
+
+import (
+	"fmt"
+	"log"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/BurntSushi/xgb"
+	"github.com/kijimaD/xruler/internal/resource"
+)
+
+// DefaultInterval 同じ種類のエラーを記録する最短の間隔
+const DefaultInterval = 10 * time.Second
+
+// unknown 原因の資源がわからないエラーの振り分け先
+const unknown = "unknown"
+
+// limit エラーの種類ごとの記録の状態
+type limit struct {
+	last       time.Time   // 最後に記録した時刻
+	suppressed int         // 最後に記録してから記録しなかった数
+	timer      *time.Timer // 記録しなかった数を間隔が空いた後に記録するタイマー
+}
+
+// Dispatcher Xエラーをサブシステムごとに数え、間隔を空けて記録する
+type Dispatcher struct {
+	mu       sync.Mutex
+	res      *resource.Tracker
+	interval time.Duration
+	counts   map[string]map[string]int // サブシステム → エラー名 → 数
+	limits   map[string]*limit         // "サブシステム/エラー名" → 記録の状態
+
+	logf      func(format string, v ...any)
+	now       func() time.Time
+	afterFunc func(d time.Duration, f func()) *time.Timer
+}
+
+// NewDispatcher 資源の記録を使ってエラーを振り分けるDispatcherを作る
+func NewDispatcher(res *resource.Tracker, interval time.Duration) *Dispatcher {
+	return &Dispatcher{
+		res:       res,
+		interval:  interval,
+		counts:    make(map[string]map[string]int),
+		limits:    make(map[string]*limit),
+		logf:      log.Printf,
+		now:       time.Now,
+		afterFunc: time.AfterFunc,
+	}
+}
+
+// Handle Xエラーを数え、前回の記録から間隔が空いていれば記録する
+func (d *Dispatcher) Handle(err xgb.Error) {
+	subsystem, source := d.resolve(err.BadId())
+	name := errorName(err)
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.counts[subsystem] == nil {
+		d.counts[subsystem] = make(map[string]int)
+	}
+	d.counts[subsystem][name]++
+
+	key := subsystem + "/" + name
+	l, ok := d.limits[key]
+	if !ok {
+		l = &limit{}
+		d.limits[key] = l
+	}
+	now := d.now()
+	if ok && now.Sub(l.last) < d.interval {
+		l.suppressed++
+		// 同じエラーが続かなくても省略した数がわかるよう、間隔が空いたら記録する
+		if l.timer == nil {
+			l.timer = d.afterFunc(l.last.Add(d.interval).Sub(now), func() { d.flush(subsystem, name) })
+		}
+		return
+	}
+
+	msg := fmt.Sprintf("Xエラー（%s, %s）: %v", subsystem, source, err)
+	if l.suppressed > 0 {
+		msg += fmt.Sprintf("（前回の記録から同じエラーを%d件省略）", l.suppressed)
+	}
+	d.logf("%s", msg)
+	l.last = now
+	l.suppressed = 0
+	l.stop()
+}
+
+// Flush 記録しなかったエラーの数をすぐに記録する（終了時に呼ぶ）
+func (d *Dispatcher) Flush() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	keys := make([]string, 0, len(d.limits))
+	for key := range d.limits {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+	for _, key := range keys {
+		subsystem, name, _ := strings.Cut(key, "/")
+		d.report(subsystem, name, d.limits[key])
+	}
+}
+
+// flush 間隔が空いた後に、記録しなかったエラーの数を記録する
+func (d *Dispatcher) flush(subsystem, name string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if l, ok := d.limits[subsystem+"/"+name]; ok {
+		l.timer = nil
+		d.report(subsystem, name, l)
+	}
+}
+
+// report 記録しなかったエラーがあればその数を記録する
+// 呼び出し側で d.mu をロックしておくこと
+func (d *Dispatcher) report(subsystem, name string, l *limit) {
+	l.stop()
+	if l.suppressed == 0 {
+		return
+	}
+	d.logf("Xエラー（%s）: 前回の記録から同じエラー（%s）を%d件省略", subsystem, name, l.suppressed)
+	l.last = d.now()
+	l.suppressed = 0
+}
+
+// stop 記録しなかった数を記録するタイマーを止める
+func (l *limit) stop() {
+	if l.timer != nil {
+		l.timer.Stop()
+		l.timer = nil
+	}
+}
+
+// Counts これまでに受け取ったエラーの数をサブシステムとエラー名ごとに返す
+func (d *Dispatcher) Counts() map[string]map[string]int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	counts := make(map[string]map[string]int, len(d.counts))
+	for subsystem, names := range d.counts {
+		counts[subsystem] = make(map[string]int, len(names))
+		for name, n := range names {
+			counts[subsystem][name] = n
+		}
+	}
+	return counts
+}
+
+// resolve エラーの原因になった資源のサブシステムと、記録に載せる資源の説明を返す
+// 持ち主のない資源は種類で振り分ける
+func (d *Dispatcher) resolve(id uint32) (subsystem, source string) {
+	kind, owner, ok := d.res.Lookup(id)
+	if !ok {
+		return unknown, fmt.Sprintf("0x%x", id)
+	}
+	source = fmt.Sprintf("%s 0x%x", kind, id)
+	if owner == "" {
+		return string(kind), source
+	}
+	return owner, source
+}
+
+// errorName エラーの名前（BadWindow など）を返す
+func errorName(err xgb.Error) string {
+	name, _, _ := strings.Cut(err.Error(), " ")
+	return name
+}
@@ -0,0 +1,151 @@
+package xerror
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/BurntSushi/xgb/xproto"
+	"github.com/kijimaD/xruler/internal/resource"
+)
+
+// newTestDispatcher 記録した文字列を集めるDispatcherを作る（時刻はclockで進める）
+func newTestDispatcher(res *resource.Tracker) (*Dispatcher, *[]string, *time.Time) {
+	d := NewDispatcher(res, 10*time.Second)
+	var logs []string
+	d.logf = func(format string, v ...any) { logs = append(logs, fmt.Sprintf(format, v...)) }
+	clock := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	d.now = func() time.Time { return clock }
+	fakeTimers(d)
+	return d, &logs, &clock
+}
+
+// fakeTimer afterFuncに渡された待ち時間と関数
+type fakeTimer struct {
+	delay time.Duration
+	fire  func()
+}
+
+// fakeTimers afterFuncに渡された関数を発火させずに集める
+func fakeTimers(d *Dispatcher) *[]fakeTimer {
+	var timers []fakeTimer
+	d.afterFunc = func(delay time.Duration, f func()) *time.Timer {
+		timers = append(timers, fakeTimer{delay: delay, fire: f})
+		return time.NewTimer(time.Hour)
+	}
+	return &timers
+}
+
+func TestHandleCounts(t *testing.T) {
+	res := resource.NewTracker()
+	res.Add(resource.Window, 1)
+	res.SetOwner(1, "trail")
+	res.Add(resource.Pixmap, 2)
+	d, _, _ := newTestDispatcher(res)
+
+	d.Handle(xproto.WindowError{BadValue: 1})
+	d.Handle(xproto.WindowError{BadValue: 1})
+	d.Handle(xproto.DrawableError{BadValue: 2})
+	d.Handle(xproto.MatchError{BadValue: 99})
+
+	want := map[string]map[string]int{
+		"trail":   {"BadWindow": 2},
+		"pixmap":  {"BadDrawable": 1},
+		"unknown": {"BadMatch": 1},
+	}
+	if got := d.Counts(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Counts() = %v, want %v", got, want)
+	}
+}
+
+func TestHandleRateLimit(t *testing.T) {
+	res := resource.NewTracker()
+	res.Add(resource.Window, 1)
+	res.SetOwner(1, "ruler")
+	d, logs, clock := newTestDispatcher(res)
+
+	d.Handle(xproto.WindowError{BadValue: 1})
+	d.Handle(xproto.WindowError{BadValue: 1})
+	d.Handle(xproto.WindowError{BadValue: 1})
+	// 種類の違うエラーは別に記録する
+	d.Handle(xproto.MatchError{BadValue: 1})
+	if len(*logs) != 2 {
+		t.Fatalf("記録 = %q, want 2件", *logs)
+	}
+	if !strings.Contains((*logs)[0], "ruler") || !strings.Contains((*logs)[0], "window 0x1") {
+		t.Errorf("記録 = %q, want サブシステムと資源を含む", (*logs)[0])
+	}
+
+	*clock = clock.Add(10 * time.Second)
+	d.Handle(xproto.WindowError{BadValue: 1})
+	if len(*logs) != 3 || !strings.Contains((*logs)[2], "2件省略") {
+		t.Fatalf("間隔を空けた記録 = %q, want 省略した数を含む", *logs)
+	}
+
+	*clock = clock.Add(10 * time.Second)
+	d.Handle(xproto.WindowError{BadValue: 1})
+	if len(*logs) != 4 || strings.Contains((*logs)[3], "省略") {
+		t.Errorf("記録 = %q, want 省略なし", (*logs)[3])
+	}
+}
+
+// TestHandleBurstThenSilence 同じエラーが途切れても、省略した数を間隔が空いた後に記録する
+func TestHandleBurstThenSilence(t *testing.T) {
+	res := resource.NewTracker()
+	res.Add(resource.Window, 1)
+	res.SetOwner(1, "trail")
+	d, logs, clock := newTestDispatcher(res)
+	timers := fakeTimers(d)
+
+	d.Handle(xproto.WindowError{BadValue: 1})
+	*clock = clock.Add(time.Second)
+	for range 3 {
+		d.Handle(xproto.WindowError{BadValue: 1})
+	}
+	if len(*logs) != 1 || len(*timers) != 1 {
+		t.Fatalf("記録 = %q, タイマー = %d, want 1件, 1つ", *logs, len(*timers))
+	}
+	if (*timers)[0].delay != 9*time.Second {
+		t.Errorf("待ち時間 = %v, want 最初の記録から間隔が空くまでの 9s", (*timers)[0].delay)
+	}
+
+	*clock = clock.Add(9 * time.Second)
+	(*timers)[0].fire()
+	if len(*logs) != 2 || !strings.Contains((*logs)[1], "trail") || !strings.Contains((*logs)[1], "BadWindow") ||
+		!strings.Contains((*logs)[1], "3件省略") {
+		t.Fatalf("記録 = %q, want 省略した3件の記録", *logs)
+	}
+
+	// 記録した後は、次の記録まで再び間隔を空ける
+	d.Handle(xproto.WindowError{BadValue: 1})
+	if len(*logs) != 2 || len(*timers) != 2 {
+		t.Errorf("記録 = %q, タイマー = %d, want 2件, 2つ", *logs, len(*timers))
+	}
+}
+
+// TestFlush 終了時には、間隔が空くのを待たずに省略した数を記録する
+func TestFlush(t *testing.T) {
+	res := resource.NewTracker()
+	d, logs, _ := newTestDispatcher(res)
+	timers := fakeTimers(d)
+
+	d.Flush()
+	if len(*logs) != 0 {
+		t.Fatalf("省略がないのに記録した: %q", *logs)
+	}
+
+	d.Handle(xproto.MatchError{BadValue: 1})
+	d.Handle(xproto.MatchError{BadValue: 1})
+	d.Flush()
+	if len(*logs) != 2 || !strings.Contains((*logs)[1], "1件省略") {
+		t.Fatalf("記録 = %q, want 省略した1件の記録", *logs)
+	}
+
+	// 止めたタイマーが発火しても、同じ省略を二重に記録しない
+	(*timers)[0].fire()
+	if len(*logs) != 2 {
+		t.Errorf("記録 = %q, want 2件のまま", *logs)
+	}
+}